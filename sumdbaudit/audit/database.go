@@ -15,54 +15,141 @@
 package audit
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Metadata is the semantic data that is contained within the leaves of the log.
 type Metadata struct {
-	module, version, repoHash, modHash string
+	Module, Version, RepoHash, ModHash string
 }
 
+// LeafMetadata is the Metadata parsed from the leaf at Index.
+type LeafMetadata struct {
+	Index int64
+	Metadata
+}
+
+// Supported database drivers.
+const (
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "postgres"
+)
+
 // Database provides read/write access to the local copy of the SumDB.
 type Database struct {
-	db *sql.DB
+	db     *sql.DB
+	driver string
 }
 
 // NewDatabase creates a Database using a file at the given location.
 // If the file doesn't exist it will be created.
 func NewDatabase(location string) (*Database, error) {
-	db, err := sql.Open("sqlite3", location)
+	return NewDatabaseWithDriver(DriverSQLite, location)
+}
+
+// NewDatabaseWithDriver creates a Database using the named driver, which must
+// be one of the supported drivers and must have been registered by the caller.
+// For SQLite the dataSourceName is the location of the file, and for Postgres
+// it is a connection string. A Postgres database can be shared by several
+// processes, e.g. to have multiple verifier jobs read from the same clone.
+func NewDatabaseWithDriver(driver, dataSourceName string) (*Database, error) {
+	switch driver {
+	case DriverSQLite, DriverPostgres:
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+	db, err := sql.Open(driver, dataSourceName)
 	if err != nil {
 		return nil, err
 	}
 	return &Database{
-		db: db,
+		db:     db,
+		driver: driver,
 	}, nil
 }
 
-// Init creates the database tables if needed.
+// Init creates the database tables if needed, and migrates the schema to the
+// latest version.
 func (d *Database) Init() error {
-	if _, err := d.db.Exec("CREATE TABLE IF NOT EXISTS leaves (id INTEGER PRIMARY KEY, data BLOB)"); err != nil {
-		return err
+	return d.Migrate(len(migrations))
+}
+
+// GoldenCheckpoint gets the most recently verified Checkpoint, or returns
+// sql.ErrNoRows if none has been stored. The parse function is used to turn
+// the stored note back into a Checkpoint, which allows callers to re-verify
+// the signature. It is given the key that the note was verified with when it
+// was stored, or an empty string if none was recorded.
+func (d *Database) GoldenCheckpoint(parse func(raw []byte, vkey string) (*Checkpoint, error)) (*Checkpoint, error) {
+	var raw []byte
+	var vkey sql.NullString
+	if err := d.db.QueryRow("SELECT raw, vkey FROM checkpoints ORDER BY size DESC, datetime DESC LIMIT 1").Scan(&raw, &vkey); err != nil {
+		return nil, err
 	}
-	if _, err := d.db.Exec("CREATE TABLE IF NOT EXISTS tiles (height INTEGER, level INTEGER, offset INTEGER, hashes BLOB, PRIMARY KEY (height, level, offset))"); err != nil {
-		return err
+	return parse(raw, vkey.String)
+}
+
+// SetGoldenCheckpoint records the Checkpoint as having been verified against
+// the contents of the local database.
+func (d *Database) SetGoldenCheckpoint(checkpoint *Checkpoint) error {
+	_, err := d.db.Exec(d.rebind("INSERT INTO checkpoints (datetime, size, hash, raw, vkey) VALUES (?, ?, ?, ?, ?)"), time.Now(), checkpoint.N, checkpoint.Hash[:], checkpoint.Raw, checkpoint.VerifierKey)
+	return err
+}
+
+// VerifiedCheckpoints returns every Checkpoint that has been verified against
+// the local database, ordered by tree size and then the time of verification.
+func (d *Database) VerifiedCheckpoints() ([]VerifiedCheckpoint, error) {
+	var res []VerifiedCheckpoint
+	rows, err := d.db.Query("SELECT datetime, size, hash, vkey FROM checkpoints ORDER BY size, datetime")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cp VerifiedCheckpoint
+		var hash []byte
+		var vkey sql.NullString
+		if err := rows.Scan(&cp.Time, &cp.N, &hash, &vkey); err != nil {
+			return nil, err
+		}
+		cp.VerifierKey = vkey.String
+		if len(hash) != HashLenBytes {
+			return nil, fmt.Errorf("checkpoint for tree size %d has hash of %d bytes", cp.N, len(hash))
+		}
+		copy(cp.Hash[:], hash)
+		res = append(res, cp)
 	}
-	_, err := d.db.Exec("CREATE TABLE IF NOT EXISTS leafMetadata (id INTEGER PRIMARY KEY, module TEXT, version TEXT, repohash TEXT, modhash TEXT)")
+	return res, rows.Err()
+}
+
+// RecordSplitView stores the evidence of a split view.
+func (d *Database) RecordSplitView(v *SplitView) error {
+	_, err := d.db.Exec(d.rebind("INSERT INTO splitViews (datetime, rawA, rawB, reason) VALUES (?, ?, ?, ?)"), time.Now(), v.A.Raw, v.B.Raw, v.Reason)
 	return err
 }
 
-// Head returns the largest leaf index written.
+// Head returns the largest leaf index written, or -1 if there are no leaves.
 func (d *Database) Head() (int64, error) {
-	var head int64
-	err := d.db.QueryRow("SELECT MAX(id) AS head FROM leaves").Scan(&head)
-	return head, err
+	var head sql.NullInt64
+	if err := d.db.QueryRow("SELECT MAX(id) AS head FROM leaves").Scan(&head); err != nil {
+		return 0, err
+	}
+	if !head.Valid {
+		return -1, nil
+	}
+	return head.Int64, nil
 }
 
 // WriteLeaves writes the contiguous chunk of leaves, starting at the stated index.
 // This is an atomic operation, and will fail if any leaf cannot be inserted.
+// Leaves which are already present are left untouched, which allows a tile to
+// be written over any stragglers previously stored for it, but it is an error
+// for a stored leaf to have different data.
 func (d *Database) WriteLeaves(ctx context.Context, start int64, leaves [][]byte) error {
 	tx, err := d.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -70,7 +157,26 @@ func (d *Database) WriteLeaves(ctx context.Context, start int64, leaves [][]byte
 	}
 	for li, l := range leaves {
 		lidx := int64(li) + start
-		tx.Exec("INSERT INTO leaves (id, data) VALUES (?, ?)", lidx, l)
+		res, err := tx.Exec(d.rebind("INSERT INTO leaves (id, data) VALUES (?, ?) ON CONFLICT DO NOTHING"), lidx, l)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to write leaf %d: %v", lidx, err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to write leaf %d: %v", lidx, err)
+		} else if n > 0 {
+			continue
+		}
+		var stored []byte
+		if err := tx.QueryRow(d.rebind("SELECT data FROM leaves WHERE id=?"), lidx).Scan(&stored); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to read leaf %d: %v", lidx, err)
+		}
+		if stored != nil && !bytes.Equal(stored, l) {
+			tx.Rollback()
+			return fmt.Errorf("leaf %d is already stored with different data", lidx)
+		}
 	}
 	return tx.Commit()
 }
@@ -78,24 +184,52 @@ func (d *Database) WriteLeaves(ctx context.Context, start int64, leaves [][]byte
 // Leaves gets a contiguous block of leaves.
 func (d *Database) Leaves(start int64, count int) ([][]byte, error) {
 	var res [][]byte
-	rows, err := d.db.Query("SELECT data FROM leaves WHERE id>=? AND id<? ORDER BY id", start, start+int64(count))
+	rows, err := d.db.Query(d.rebind("SELECT data FROM leaves WHERE id>=? AND id<? ORDER BY id"), start, start+int64(count))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var data []byte
-		rows.Scan(&data)
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
 		res = append(res, data)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 	if len(res) != count {
 		return nil, fmt.Errorf("failed to read %d leaves, only found %d", count, len(res))
 	}
-	return res, err
+	return res, nil
+}
+
+// PruneLeaves drops the data for all leaves before the given index, keeping
+// their rows so that the head of the database is unchanged. The data for pruned
+// leaves is returned as nil by Leaves.
+func (d *Database) PruneLeaves(end int64) error {
+	_, err := d.db.Exec(d.rebind("UPDATE leaves SET data=NULL WHERE id<? AND data IS NOT NULL"), end)
+	return err
+}
+
+// MetadataHead returns the largest leaf index which has metadata written, or
+// -1 if there is none.
+func (d *Database) MetadataHead() (int64, error) {
+	var head sql.NullInt64
+	if err := d.db.QueryRow("SELECT MAX(id) FROM leafMetadata").Scan(&head); err != nil {
+		return 0, err
+	}
+	if !head.Valid {
+		return -1, nil
+	}
+	return head.Int64, nil
 }
 
 // SetLeafMetadata sets the metadata for a contiguous batch of leaves.
 // This is an atomic operation, and will fail if any metadata cannot be inserted.
+// Metadata which is already present is left untouched, so that a batch can be
+// safely written again.
 func (d *Database) SetLeafMetadata(ctx context.Context, start int64, metadata []Metadata) error {
 	tx, err := d.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -103,15 +237,96 @@ func (d *Database) SetLeafMetadata(ctx context.Context, start int64, metadata []
 	}
 	for mi, m := range metadata {
 		midx := int64(mi) + start
-		tx.Exec("INSERT INTO leafMetadata (id, module, version, repohash, modhash) VALUES (?, ?, ?, ?, ?)", midx, m.module, m.version, m.repoHash, m.modHash)
+		if _, err := tx.Exec(d.rebind("INSERT INTO leafMetadata (id, module, version, repohash, modhash) VALUES (?, ?, ?, ?, ?) ON CONFLICT DO NOTHING"), midx, m.Module, m.Version, m.RepoHash, m.ModHash); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to write metadata for leaf %d: %v", midx, err)
+		}
 	}
 	return tx.Commit()
 }
 
+// LookupMetadata gets the metadata for all leaves recording the given module
+// and version, in order of leaf index. There should be at most one.
+func (d *Database) LookupMetadata(module, version string) ([]LeafMetadata, error) {
+	var res []LeafMetadata
+	rows, err := d.db.Query(d.rebind("SELECT id, module, version, repohash, modhash FROM leafMetadata WHERE module=? AND version=? ORDER BY id"), module, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m LeafMetadata
+		if err := rows.Scan(&m.Index, &m.Module, &m.Version, &m.RepoHash, &m.ModHash); err != nil {
+			return nil, err
+		}
+		res = append(res, m)
+	}
+	return res, rows.Err()
+}
+
+// MatchMetadata streams the metadata for every leaf recording the given module,
+// ordered by module and then leaf index. If subpaths is true, the metadata for
+// modules beneath it in the path hierarchy is also included, e.g. golang.org/x
+// includes golang.org/x/net. Module paths are compared exactly, including case.
+// Processing stops at the first error returned by f.
+func (d *Database) MatchMetadata(module string, subpaths bool, f func(LeafMetadata) error) error {
+	query, args := "SELECT id, module, version, repohash, modhash FROM leafMetadata WHERE module=? ORDER BY module, id", []interface{}{module}
+	if subpaths {
+		query = `SELECT id, module, version, repohash, modhash FROM leafMetadata WHERE module=? OR module LIKE ? ESCAPE '\' ORDER BY module, id`
+		args = append(args, likeEscaper.Replace(module)+"/%")
+	}
+	rows, err := d.db.Query(d.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m LeafMetadata
+		if err := rows.Scan(&m.Index, &m.Module, &m.Version, &m.RepoHash, &m.ModHash); err != nil {
+			return err
+		}
+		// SQLite compares LIKE patterns without regard to case.
+		if m.Module != module && !strings.HasPrefix(m.Module, module+"/") {
+			continue
+		}
+		if err := f(m); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// likeEscaper escapes the special characters of a LIKE pattern, for use with
+// ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Duplicates streams the metadata for every leaf that records a module and
+// version which appears in more than one leaf, ordered by module, version and
+// then leaf index. Processing stops at the first error returned by f.
+func (d *Database) Duplicates(f func(LeafMetadata) error) error {
+	rows, err := d.db.Query(`SELECT id, module, version, repohash, modhash FROM leafMetadata
+		WHERE (module, version) IN (SELECT module, version FROM leafMetadata GROUP BY module, version HAVING COUNT(*) > 1)
+		ORDER BY module, version, id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m LeafMetadata
+		if err := rows.Scan(&m.Index, &m.Module, &m.Version, &m.RepoHash, &m.ModHash); err != nil {
+			return err
+		}
+		if err := f(m); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
 // Tile gets the leaf hashes for the given tile, or returns an error.
 func (d *Database) Tile(height, level, offset int) ([][]byte, error) {
 	var res []byte
-	err := d.db.QueryRow("SELECT hashes FROM tiles WHERE height=? AND level=? AND offset=?", height, level, offset).Scan(&res)
+	err := d.db.QueryRow(d.rebind(`SELECT hashes FROM tiles WHERE height=? AND level=? AND "offset"=?`), height, level, offset).Scan(&res)
 	if err != nil {
 		return nil, err
 	}
@@ -124,10 +339,17 @@ func (d *Database) SetTile(height, level, offset int, hashes []byte) error {
 	if got, want := len(hashes), (1<<height)*HashLenBytes; got != want {
 		return fmt.Errorf("wanted %d tile hash bytes but got %d", want, got)
 	}
-	_, err := d.db.Exec("INSERT INTO tiles (height, level, offset, hashes) VALUES (?, ?, ?, ?)", height, level, offset, hashes)
+	_, err := d.db.Exec(d.rebind(`INSERT INTO tiles (height, level, "offset", hashes) VALUES (?, ?, ?, ?)`), height, level, offset, hashes)
 	return err
 }
 
+// TileCount returns the number of tiles stored at the given height and level.
+func (d *Database) TileCount(height, level int) (int, error) {
+	var count int
+	err := d.db.QueryRow(d.rebind("SELECT COUNT(*) FROM tiles WHERE height=? AND level=?"), height, level).Scan(&count)
+	return count, err
+}
+
 // SplitTile turns the blob that is the leaf hashes in a tile into separate hashes.
 func SplitTile(hashes []byte, height int) [][]byte {
 	tileWidth := 1 << height
@@ -138,3 +360,22 @@ func SplitTile(hashes []byte, height int) [][]byte {
 	}
 	return res
 }
+
+// rebind converts the ?-style placeholders in query into the style needed by
+// the database driver.
+func (d *Database) rebind(query string) string {
+	if d.driver != DriverPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
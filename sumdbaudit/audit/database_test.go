@@ -0,0 +1,193 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// postgresEnv names the environment variable holding the connection string of
+// a Postgres database to run tests against. All tables in it will be dropped.
+const postgresEnv = "SUMDBAUDIT_TEST_POSTGRES"
+
+// openTestDatabase opens an empty SQLite database in a temporary directory.
+// The returned function closes the database and removes it.
+func openTestDatabase(t *testing.T) (*Database, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "sumdbaudit")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	d, err := NewDatabase(filepath.Join(dir, "sumdb.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	return d, func() {
+		d.db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// newTestDatabase is like openTestDatabase, but the database is initialised.
+func newTestDatabase(t *testing.T) (*Database, func()) {
+	t.Helper()
+	d, cleanup := openTestDatabase(t)
+	if err := d.Init(); err != nil {
+		cleanup()
+		t.Fatalf("Init: %v", err)
+	}
+	return d, cleanup
+}
+
+// forEachDatabase runs f against an empty SQLite database, and against an empty
+// Postgres database if one is configured by postgresEnv. The databases are not
+// initialised.
+func forEachDatabase(t *testing.T, f func(t *testing.T, d *Database)) {
+	t.Run("sqlite", func(t *testing.T) {
+		d, cleanup := openTestDatabase(t)
+		defer cleanup()
+		f(t, d)
+	})
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv(postgresEnv)
+		if len(dsn) == 0 {
+			t.Skipf("%s not set", postgresEnv)
+		}
+		d, err := NewDatabaseWithDriver(DriverPostgres, dsn)
+		if err != nil {
+			t.Fatalf("NewDatabaseWithDriver: %v", err)
+		}
+		defer d.db.Close()
+		if _, err := d.db.Exec("DROP TABLE IF EXISTS leaves, tiles, leafMetadata, checkpoints, splitViews, schemaVersion"); err != nil {
+			t.Fatalf("failed to drop tables: %v", err)
+		}
+		f(t, d)
+	})
+}
+
+func TestRebind(t *testing.T) {
+	for _, test := range []struct {
+		driver string
+		query  string
+		want   string
+	}{
+		{
+			driver: DriverSQLite,
+			query:  "SELECT data FROM leaves WHERE id>=? AND id<?",
+			want:   "SELECT data FROM leaves WHERE id>=? AND id<?",
+		},
+		{
+			driver: DriverPostgres,
+			query:  "SELECT data FROM leaves WHERE id>=? AND id<?",
+			want:   "SELECT data FROM leaves WHERE id>=$1 AND id<$2",
+		},
+		{
+			driver: DriverPostgres,
+			query:  "SELECT MAX(id) AS head FROM leaves",
+			want:   "SELECT MAX(id) AS head FROM leaves",
+		},
+	} {
+		d := &Database{driver: test.driver}
+		if got := d.rebind(test.query); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.driver, got, test.want)
+		}
+	}
+}
+
+func TestNewDatabaseWithDriverUnsupported(t *testing.T) {
+	if _, err := NewDatabaseWithDriver("mysql", "unused"); err == nil {
+		t.Error("expected error for unsupported driver")
+	}
+}
+
+func TestWriteLeavesConflict(t *testing.T) {
+	d, cleanup := newTestDatabase(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	if err := d.WriteLeaves(ctx, 4, [][]byte{[]byte("a"), []byte("b")}); err != nil {
+		t.Fatalf("WriteLeaves: %v", err)
+	}
+	// Rewriting the same data, e.g. a full tile over stragglers, is allowed.
+	if err := d.WriteLeaves(ctx, 4, [][]byte{[]byte("a"), []byte("b"), []byte("c")}); err != nil {
+		t.Fatalf("WriteLeaves over the same data: %v", err)
+	}
+	if err := d.WriteLeaves(ctx, 4, [][]byte{[]byte("a"), []byte("x")}); err == nil {
+		t.Error("expected error writing different data over a stored leaf")
+	}
+	got, err := d.Leaves(4, 3)
+	if err != nil {
+		t.Fatalf("Leaves: %v", err)
+	}
+	for i, want := range []string{"a", "b", "c"} {
+		if string(got[i]) != want {
+			t.Errorf("leaf %d: got %q, want %q", 4+i, got[i], want)
+		}
+	}
+}
+
+func TestGoldenCheckpointRetiredKey(t *testing.T) {
+	d, cleanup := newTestDatabase(t)
+	defer cleanup()
+	m := newMemoryLog(t, moduleLeaves(4))
+	cp := m.checkpoint(t, 4)
+	if err := d.SetGoldenCheckpoint(cp); err != nil {
+		t.Fatalf("SetGoldenCheckpoint: %v", err)
+	}
+
+	// After a rotation, the key that signed the golden checkpoint has been
+	// retired, but the checkpoint must still be trusted.
+	_, newVKey, err := note.GenerateKey(rand.Reader, "sumdb.example.com")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	rotated, err := NewSumDBWithKeys(2, []string{newVKey}, HTTPOptions{})
+	if err != nil {
+		t.Fatalf("NewSumDBWithKeys: %v", err)
+	}
+	if _, err := rotated.ParseCheckpointNote(cp.Raw); err == nil {
+		t.Fatal("expected error parsing checkpoint signed by retired key")
+	}
+	golden, err := d.GoldenCheckpoint(rotated.ParseStoredCheckpoint)
+	if err != nil {
+		t.Fatalf("GoldenCheckpoint: %v", err)
+	}
+	if golden.N != cp.N || golden.VerifierKey != cp.VerifierKey {
+		t.Errorf("got golden checkpoint %d with key %q, want %d with key %q", golden.N, golden.VerifierKey, cp.N, cp.VerifierKey)
+	}
+
+	// The recorded key must be for the same SumDB.
+	_, otherVKey, err := note.GenerateKey(rand.Reader, "other.example.com")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	other, err := NewSumDBWithKeys(2, []string{otherVKey}, HTTPOptions{})
+	if err != nil {
+		t.Fatalf("NewSumDBWithKeys: %v", err)
+	}
+	if _, err := d.GoldenCheckpoint(other.ParseStoredCheckpoint); err == nil {
+		t.Error("expected error for golden checkpoint of another SumDB")
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// ExportTiles provides the data for every tile in the tree at the checkpoint,
+// in the same formats served by the SumDB, to the write function. Hash tiles
+// are provided for all levels, along with a data tile for each tile at level 0.
+// This includes any partial tiles on the right edge of the tree. Paths for the
+// tiles can be obtained using tlog.Tile.Path().
+func (s *Service) ExportTiles(ctx context.Context, checkpoint *tlog.Tree, write func(t tlog.Tile, data []byte) error) error {
+	for _, t := range tlog.NewTiles(s.height, 0, checkpoint.N) {
+		tiles := []tlog.Tile{t}
+		if t.L == 0 {
+			dt := t
+			dt.L = -1
+			tiles = append(tiles, dt)
+		}
+		for _, t := range tiles {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			data, err := s.TileData(t)
+			if err != nil {
+				return err
+			}
+			if err := write(t, data); err != nil {
+				return fmt.Errorf("failed to write tile %s: %v", t.Path(), err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestExportTiles(t *testing.T) {
+	d, cleanup := newTestDatabase(t)
+	defer cleanup()
+	m := newMemoryLog(t, moduleLeaves(19))
+	s := NewService(d, m.client, 2)
+	clone(t, s, m, 19)
+
+	for _, size := range []int64{19, 16, 6} {
+		cp := m.checkpoint(t, size)
+		exported := make(map[string][]byte)
+		err := s.ExportTiles(context.Background(), &cp.Tree, func(t tlog.Tile, data []byte) error {
+			exported[t.Path()] = data
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ExportTiles(%d): %v", size, err)
+		}
+
+		tiles := tlog.NewTiles(2, 0, size)
+		for _, tile := range tiles {
+			want, err := tlog.ReadTileData(tile, m.hashes)
+			if err != nil {
+				t.Fatalf("ReadTileData(%s): %v", tile.Path(), err)
+			}
+			if got := exported[tile.Path()]; !bytes.Equal(got, want) {
+				t.Errorf("size %d: tile %s: got %x, want %x", size, tile.Path(), got, want)
+			}
+			if tile.L != 0 {
+				continue
+			}
+			start := tile.N << uint(tile.H)
+			tile.L = -1
+			want = []byte(strings.Join(m.leaves[start:start+int64(tile.W)], "\n"))
+			if got := exported[tile.Path()]; !bytes.Equal(got, want) {
+				t.Errorf("size %d: tile %s: got %q, want %q", size, tile.Path(), got, want)
+			}
+		}
+		var levelZero int
+		for _, tile := range tiles {
+			if tile.L == 0 {
+				levelZero++
+			}
+		}
+		if got, want := len(exported), len(tiles)+levelZero; got != want {
+			t.Errorf("size %d: got %d tiles exported, want %d", size, got, want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+)
+
+// tileStore reads and writes tile hashes. This is implemented by Database, and
+// allows the hashing to be tested and benchmarked without one.
+type tileStore interface {
+	// Tile returns the hashes in the tile, or sql.ErrNoRows if it is not stored.
+	Tile(height, level, offset int) ([][]byte, error)
+	// SetTile stores the concatenated hashes of the tile.
+	SetTile(height, level, offset int, hashes []byte) error
+	// TileCount returns the number of tiles stored at the level. Tiles are
+	// always stored in order, so these are the tiles at offsets [0, count).
+	TileCount(height, level int) (int, error)
+}
+
+// tileHasher calculates the tiles above level 0 from a stream of complete level
+// 0 tiles, given in order. The roots of the tiles at each level are collected
+// into a frontier until they form a complete tile on the level above, which is
+// then checked against the stored tile, or stored if it is new.
+//
+// Only the frontier is held in memory, which is at most 2^height hashes for each
+// level, e.g. 8KiB per level for the default height of 8. The frontier is not
+// persisted separately, as it is made up of the roots of tiles which have
+// already been stored; resume derives it from them so that hashing can carry on
+// from the last stored tile.
+type tileHasher struct {
+	height int
+	store  tileStore
+	root   func(hashes [][]byte) ([]byte, error)
+
+	// frontier[l] holds the hashes so far of the next tile at level l, and
+	// offsets[l] is the offset of that tile. Level 0 is unused.
+	frontier [][][]byte
+	offsets  []int
+}
+
+func newTileHasher(height int, store tileStore, root func([][]byte) ([]byte, error)) *tileHasher {
+	return &tileHasher{
+		height: height,
+		store:  store,
+		root:   root,
+	}
+}
+
+// resume derives the frontier from the tiles already stored, and returns the
+// number of level 0 tiles which it covers. Hashing then carries on by adding
+// the level 0 tiles from that offset. This must be called before any tiles
+// are added.
+func (h *tileHasher) resume() (int, error) {
+	var counts []int
+	for {
+		count, err := h.store.TileCount(h.height, len(counts))
+		if err != nil {
+			return 0, fmt.Errorf("failed to count tiles at L=%d: %v", len(counts), err)
+		}
+		if count == 0 {
+			break
+		}
+		counts = append(counts, count)
+	}
+	if len(counts) == 0 {
+		return 0, nil
+	}
+	h.grow(len(counts))
+	// The frontier at each level is the roots of the stored tiles on the level
+	// below which are not yet covered by a stored tile. Working down from the
+	// top means that if hashing was interrupted before a completed tile was
+	// stored, adding it now correctly extends the frontier above.
+	for level := len(counts); level > 0; level-- {
+		if level < len(counts) {
+			h.offsets[level] = counts[level]
+		}
+		for offset := h.offsets[level] << uint(h.height); offset < counts[level-1]; offset++ {
+			hashes, err := h.store.Tile(h.height, level-1, offset)
+			if err != nil {
+				return 0, fmt.Errorf("failed to get tile at L=%d, O=%d: %v", level-1, offset, err)
+			}
+			if err := h.add(level-1, hashes); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return counts[0], nil
+}
+
+// grow extends the frontier up to the given level.
+func (h *tileHasher) grow(level int) {
+	for len(h.frontier) <= level {
+		h.frontier = append(h.frontier, make([][]byte, 0, 1<<h.height))
+		h.offsets = append(h.offsets, 0)
+	}
+}
+
+// add processes the next complete tile at the given level, and recursively
+// any tiles on the levels above which it completes.
+func (h *tileHasher) add(level int, hashes [][]byte) error {
+	root, err := h.root(hashes)
+	if err != nil {
+		return err
+	}
+	level++
+	h.grow(level)
+	h.frontier[level] = append(h.frontier[level], root)
+	if len(h.frontier[level]) < 1<<h.height {
+		return nil
+	}
+
+	tile, offset := h.frontier[level], h.offsets[level]
+	stored, err := h.store.Tile(h.height, level, offset)
+	switch {
+	case err == sql.ErrNoRows:
+		if err := h.store.SetTile(h.height, level, offset, bytes.Join(tile, nil)); err != nil {
+			return fmt.Errorf("failed to set tile at L=%d, O=%d: %v", level, offset, err)
+		}
+	case err != nil:
+		return err
+	default:
+		for i := range tile {
+			if !bytes.Equal(stored[i], tile[i]) {
+				return &IntegrityError{Err: fmt.Errorf("got diffence in hash at L=%d, O=%d, leaf=%d", level, offset, i)}
+			}
+		}
+	}
+	if err := h.add(level, tile); err != nil {
+		return err
+	}
+	h.frontier[level] = h.frontier[level][:0]
+	h.offsets[level]++
+	return nil
+}
@@ -0,0 +1,207 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// memoryTileStore is a tileStore which keeps tiles in memory.
+type memoryTileStore map[string][]byte
+
+func (m memoryTileStore) Tile(height, level, offset int) ([][]byte, error) {
+	data, ok := m[fmt.Sprintf("%d/%d/%d", height, level, offset)]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	var res [][]byte
+	for i := 0; i < len(data); i += HashLenBytes {
+		res = append(res, data[i:i+HashLenBytes])
+	}
+	return res, nil
+}
+
+func (m memoryTileStore) SetTile(height, level, offset int, hashes []byte) error {
+	m[fmt.Sprintf("%d/%d/%d", height, level, offset)] = append([]byte(nil), hashes...)
+	return nil
+}
+
+func (m memoryTileStore) TileCount(height, level int) (int, error) {
+	var count int
+	for count = 0; ; count++ {
+		if _, ok := m[fmt.Sprintf("%d/%d/%d", height, level, count)]; !ok {
+			return count, nil
+		}
+	}
+}
+
+// leafTiles returns the record hashes of count leaves, split into tiles.
+func leafTiles(height, count int) [][][]byte {
+	var tiles [][][]byte
+	for i := 0; i < count; i++ {
+		if i%(1<<height) == 0 {
+			tiles = append(tiles, nil)
+		}
+		h := tlog.RecordHash([]byte(fmt.Sprintf("leaf %d\n", i)))
+		tiles[len(tiles)-1] = append(tiles[len(tiles)-1], h[:])
+	}
+	return tiles
+}
+
+func TestTileHasher(t *testing.T) {
+	const height, leaves = 2, 64
+	s := NewService(nil, nil, height)
+	store := make(memoryTileStore)
+	h := newTileHasher(height, store, s.tileRoot)
+	for _, tile := range leafTiles(height, leaves) {
+		if err := h.add(0, tile); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+	if got, want := len(store), 4+1; got != want {
+		t.Fatalf("got %d tiles stored, want %d", got, want)
+	}
+
+	top, err := store.Tile(height, 2, 0)
+	if err != nil {
+		t.Fatalf("failed to get top tile: %v", err)
+	}
+	root, err := s.tileRoot(top)
+	if err != nil {
+		t.Fatalf("tileRoot: %v", err)
+	}
+	var hashes []tlog.Hash
+	for i := 0; i < leaves; i++ {
+		hashes = append(hashes, tlog.RecordHash([]byte(fmt.Sprintf("leaf %d\n", i))))
+	}
+	// The tree is perfect, so the top tile covers all of the leaves.
+	want := subtreeHash(hashes, 6, 0)
+	if !bytes.Equal(root, want[:]) {
+		t.Errorf("got root %x, want %x", root, want[:])
+	}
+
+	// Hashing again should verify against the stored tiles.
+	h = newTileHasher(height, store, s.tileRoot)
+	tiles := leafTiles(height, leaves)
+	for _, tile := range tiles {
+		if err := h.add(0, tile); err != nil {
+			t.Fatalf("add again: %v", err)
+		}
+	}
+
+	// Any change in the leaves should be detected.
+	tiles[5][1] = tiles[5][2]
+	h = newTileHasher(height, store, s.tileRoot)
+	var addErr error
+	for _, tile := range tiles {
+		if addErr = h.add(0, tile); addErr != nil {
+			break
+		}
+	}
+	if addErr == nil {
+		t.Error("expected error for modified leaf")
+	}
+}
+
+func TestTileHasherResume(t *testing.T) {
+	const height, leaves = 2, 256
+	s := NewService(nil, nil, height)
+	tiles := leafTiles(height, leaves)
+	// addTiles stores the level 0 tiles in the range, as HashTiles does, and
+	// adds them to the hasher.
+	addTiles := func(h *tileHasher, store memoryTileStore, start, end int) {
+		t.Helper()
+		for i := start; i < end; i++ {
+			if err := store.SetTile(height, 0, i, bytes.Join(tiles[i], nil)); err != nil {
+				t.Fatalf("SetTile: %v", err)
+			}
+			if err := h.add(0, tiles[i]); err != nil {
+				t.Fatalf("add(%d): %v", i, err)
+			}
+		}
+	}
+	want := make(memoryTileStore)
+	addTiles(newTileHasher(height, want, s.tileRoot), want, 0, len(tiles))
+
+	for _, test := range []struct {
+		name    string
+		done    int      // Level 0 tiles hashed before the interruption
+		missing []string // Tiles which were not stored before the interruption
+	}{
+		{name: "empty", done: 0},
+		{name: "partial", done: 5},
+		{name: "perfect", done: 4},
+		{name: "two levels", done: 17},
+		{name: "interrupted before parent", done: 16, missing: []string{"2/1/3", "2/2/0"}},
+		{name: "interrupted before grandparent", done: 16, missing: []string{"2/2/0"}},
+		{name: "complete", done: 64},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			store := make(memoryTileStore)
+			addTiles(newTileHasher(height, store, s.tileRoot), store, 0, test.done)
+			for _, k := range test.missing {
+				delete(store, k)
+			}
+
+			h := newTileHasher(height, store, s.tileRoot)
+			start, err := h.resume()
+			if err != nil {
+				t.Fatalf("resume: %v", err)
+			}
+			if start != test.done {
+				t.Fatalf("resumed from %d, want %d", start, test.done)
+			}
+			addTiles(h, store, start, len(tiles))
+			if len(store) != len(want) {
+				t.Errorf("got %d tiles stored, want %d", len(store), len(want))
+			}
+			for k, v := range want {
+				if !bytes.Equal(store[k], v) {
+					t.Errorf("tile %s: got %x, want %x", k, store[k], v)
+				}
+			}
+		})
+	}
+}
+
+// subtreeHash calculates the hash of the perfect subtree of 2^level leaves
+// starting at leaf n<<level.
+func subtreeHash(leaves []tlog.Hash, level int, n int64) tlog.Hash {
+	if level == 0 {
+		return leaves[n]
+	}
+	return tlog.NodeHash(subtreeHash(leaves, level-1, 2*n), subtreeHash(leaves, level-1, 2*n+1))
+}
+
+func BenchmarkTileHasher(b *testing.B) {
+	const height = 8
+	s := NewService(nil, nil, height)
+	tiles := leafTiles(height, 1<<16)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h := newTileHasher(height, make(memoryTileStore), s.tileRoot)
+		for _, tile := range tiles {
+			if err := h.add(0, tile); err != nil {
+				b.Fatalf("add: %v", err)
+			}
+		}
+	}
+}
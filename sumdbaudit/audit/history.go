@@ -0,0 +1,129 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// VerifiedCheckpoint is a tree head which was verified against the local
+// database at the given time.
+type VerifiedCheckpoint struct {
+	tlog.Tree
+	Time        time.Time
+	VerifierKey string // Empty if verified before signing keys were recorded
+}
+
+// ModuleVersion is a leaf recording the hashes for a module version, along with
+// the first Checkpoint that the auditor verified as including it.
+type ModuleVersion struct {
+	LeafMetadata
+	// FirstSeen is nil if no verified Checkpoint includes the leaf, which is
+	// only possible for databases created before Checkpoints were recorded.
+	FirstSeen *VerifiedCheckpoint
+}
+
+// ModuleHistory finds every version of the modules matching the pattern, which
+// is either a module path, or a module path followed by /... to also match all
+// modules beneath it, e.g. golang.org/x/... for golang.org/x/net and others.
+// ProcessMetadata must have been run first.
+func (s *Service) ModuleHistory(ctx context.Context, pattern string) ([]ModuleVersion, error) {
+	cps, err := s.localDB.VerifiedCheckpoints()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get verified checkpoints: %v", err)
+	}
+	var res []ModuleVersion
+	module := strings.TrimSuffix(pattern, "/...")
+	err = s.localDB.MatchMetadata(module, module != pattern, func(m LeafMetadata) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		mv := ModuleVersion{LeafMetadata: m}
+		// The first verified Checkpoint to include a leaf is the smallest tree
+		// containing it, as the log only grows over time.
+		if i := sort.Search(len(cps), func(i int) bool { return cps[i].N > m.Index }); i < len(cps) {
+			mv.FirstSeen = &cps[i]
+		}
+		res = append(res, mv)
+		return nil
+	})
+	return res, err
+}
+
+// historyRecord is the JSON representation of a ModuleVersion.
+type historyRecord struct {
+	Module        string     `json:"module"`
+	Version       string     `json:"version"`
+	RepoHash      string     `json:"repo_hash"`
+	ModHash       string     `json:"mod_hash"`
+	Index         int64      `json:"index"`
+	FirstSeenSize int64      `json:"first_seen_size,omitempty"`
+	FirstSeenHash string     `json:"first_seen_hash,omitempty"`
+	FirstSeenTime *time.Time `json:"first_seen_time,omitempty"`
+}
+
+// WriteHistoryJSON writes the module versions as a JSON array.
+func WriteHistoryJSON(w io.Writer, history []ModuleVersion) error {
+	records := make([]historyRecord, len(history))
+	for i, mv := range history {
+		records[i] = historyRecord{
+			Module:   mv.Module,
+			Version:  mv.Version,
+			RepoHash: mv.RepoHash,
+			ModHash:  mv.ModHash,
+			Index:    mv.Index,
+		}
+		if cp := mv.FirstSeen; cp != nil {
+			records[i].FirstSeenSize = cp.N
+			records[i].FirstSeenHash = cp.Hash.String()
+			records[i].FirstSeenTime = &cp.Time
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+// WriteHistoryCSV writes the module versions as CSV, with a header row. The
+// first seen columns are empty for leaves without a verified Checkpoint.
+func WriteHistoryCSV(w io.Writer, history []ModuleVersion) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"module", "version", "repo_hash", "mod_hash", "index", "first_seen_size", "first_seen_hash", "first_seen_time"}); err != nil {
+		return err
+	}
+	for _, mv := range history {
+		row := []string{mv.Module, mv.Version, mv.RepoHash, mv.ModHash, strconv.FormatInt(mv.Index, 10), "", "", ""}
+		if cp := mv.FirstSeen; cp != nil {
+			row[5] = strconv.FormatInt(cp.N, 10)
+			row[6] = cp.Hash.String()
+			row[7] = cp.Time.UTC().Format(time.RFC3339)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func testHistory() []ModuleVersion {
+	cp := &VerifiedCheckpoint{
+		Tree: tlog.Tree{N: 10},
+		Time: time.Date(2020, 8, 1, 12, 0, 0, 0, time.UTC),
+	}
+	return []ModuleVersion{
+		{
+			LeafMetadata: LeafMetadata{Index: 3, Metadata: Metadata{Module: "example.com/a", Version: "v1.0.0", RepoHash: "h1:repo=", ModHash: "h1:mod="}},
+			FirstSeen:    cp,
+		},
+		{
+			LeafMetadata: LeafMetadata{Index: 12, Metadata: Metadata{Module: "example.com/a", Version: "v1.1.0", RepoHash: "h1:repo2=", ModHash: "h1:mod2="}},
+		},
+	}
+}
+
+func TestWriteHistoryCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteHistoryCSV(&buf, testHistory()); err != nil {
+		t.Fatalf("WriteHistoryCSV: %v", err)
+	}
+	want := "module,version,repo_hash,mod_hash,index,first_seen_size,first_seen_hash,first_seen_time\n" +
+		"example.com/a,v1.0.0,h1:repo=,h1:mod=,3,10,AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=,2020-08-01T12:00:00Z\n" +
+		"example.com/a,v1.1.0,h1:repo2=,h1:mod2=,12,,,\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteHistoryJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteHistoryJSON(&buf, testHistory()); err != nil {
+		t.Fatalf("WriteHistoryJSON: %v", err)
+	}
+	var got []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d records, want 2", len(got))
+	}
+	if got, want := got[0]["first_seen_size"], float64(10); got != want {
+		t.Errorf("first_seen_size got %v, want %v", got, want)
+	}
+	if _, ok := got[1]["first_seen_size"]; ok {
+		t.Errorf("unexpected first_seen_size for leaf without checkpoint")
+	}
+}
+
+func TestModuleHistory(t *testing.T) {
+	modules := []string{
+		"example.com/a_b",
+		"example.com/a_b/sub",
+		"example.com/axb",
+		"example.com/axb/sub",
+		"example.com/A_b",
+		"example.com/A_b/sub",
+		"example.com/100%",
+		"example.com/1000",
+		`example.com/back\slash`,
+	}
+	forEachDatabase(t, func(t *testing.T, d *Database) {
+		if err := d.Init(); err != nil {
+			t.Fatalf("Init: %v", err)
+		}
+		var metadata []Metadata
+		for _, m := range modules {
+			metadata = append(metadata, Metadata{Module: m, Version: "v1.0.0"})
+		}
+		if err := d.SetLeafMetadata(context.Background(), 0, metadata); err != nil {
+			t.Fatalf("SetLeafMetadata: %v", err)
+		}
+		if err := d.SetGoldenCheckpoint(&Checkpoint{Tree: tlog.Tree{N: 4}}); err != nil {
+			t.Fatalf("SetGoldenCheckpoint: %v", err)
+		}
+		s := NewService(d, nil, 2)
+
+		for _, test := range []struct {
+			pattern string
+			want    []string
+		}{
+			{pattern: "example.com/a_b", want: []string{"example.com/a_b"}},
+			{pattern: "example.com/a_b/...", want: []string{"example.com/a_b", "example.com/a_b/sub"}},
+			{pattern: "example.com/A_b/...", want: []string{"example.com/A_b", "example.com/A_b/sub"}},
+			{pattern: "example.com/100%", want: []string{"example.com/100%"}},
+			{pattern: "example.com/100%/...", want: []string{"example.com/100%"}},
+			{pattern: `example.com/back\slash/...`, want: []string{`example.com/back\slash`}},
+			{pattern: "example.com/a%", want: nil},
+			{pattern: "example.com/...", want: modules},
+		} {
+			history, err := s.ModuleHistory(context.Background(), test.pattern)
+			if err != nil {
+				t.Fatalf("ModuleHistory(%q): %v", test.pattern, err)
+			}
+			got := make(map[string]bool)
+			for _, mv := range history {
+				got[mv.Module] = true
+				if wantSeen := mv.Index < 4; (mv.FirstSeen != nil) != wantSeen {
+					t.Errorf("ModuleHistory(%q): %s first seen %v, want seen %t", test.pattern, mv.Module, mv.FirstSeen, wantSeen)
+				}
+			}
+			want := make(map[string]bool)
+			for _, m := range test.want {
+				want[m] = true
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("ModuleHistory(%q): got modules %v, want %v", test.pattern, got, want)
+			}
+		}
+	})
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// DefaultHookTimeout is how long a Hook is given to handle each Advancement,
+// unless configured otherwise.
+const DefaultHookTimeout = 30 * time.Second
+
+// Advancement describes the growth of the SumDB from one verified Checkpoint to
+// the next. The old size is 0 for the first Checkpoint verified.
+type Advancement struct {
+	OldSize    int64  `json:"old_size"`
+	OldHash    string `json:"old_hash"`
+	NewSize    int64  `json:"new_size"`
+	NewHash    string `json:"new_hash"`
+	Checkpoint string `json:"checkpoint"` // The signed note for the new Checkpoint
+}
+
+// NewAdvancement describes the growth from the older to the newer Checkpoint.
+// The older Checkpoint may be nil.
+func NewAdvancement(older, newer *Checkpoint) Advancement {
+	a := Advancement{
+		NewSize:    newer.N,
+		NewHash:    newer.Hash.String(),
+		Checkpoint: string(newer.Raw),
+	}
+	if older != nil {
+		a.OldSize, a.OldHash = older.N, older.Hash.String()
+	}
+	return a
+}
+
+// Hook is notified each time a new Checkpoint has been verified, so that other
+// systems can react to the growth of the SumDB.
+type Hook interface {
+	Notify(ctx context.Context, a Advancement) error
+}
+
+// CommandHook runs a shell command for each Advancement. The sizes and hashes
+// are given in the environment variables SUMDB_OLD_SIZE, SUMDB_OLD_HASH,
+// SUMDB_NEW_SIZE and SUMDB_NEW_HASH, and the signed note is given on stdin.
+type CommandHook struct {
+	Command string
+	Timeout time.Duration // If zero, DefaultHookTimeout is used
+}
+
+// Notify runs the command, returning an error if it does not succeed. The
+// command is killed if it has not finished within the timeout.
+func (h CommandHook) Notify(ctx context.Context, a Advancement) error {
+	ctx, cancel := context.WithTimeout(ctx, hookTimeout(h.Timeout))
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", h.Command)
+	cmd.Env = append(os.Environ(),
+		"SUMDB_OLD_SIZE="+strconv.FormatInt(a.OldSize, 10),
+		"SUMDB_OLD_HASH="+a.OldHash,
+		"SUMDB_NEW_SIZE="+strconv.FormatInt(a.NewSize, 10),
+		"SUMDB_NEW_HASH="+a.NewHash,
+	)
+	cmd.Stdin = bytes.NewReader([]byte(a.Checkpoint))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("command %q failed: %v\n%s", h.Command, err, out)
+	}
+	return nil
+}
+
+// WebhookHook POSTs each Advancement to a URL as JSON.
+type WebhookHook struct {
+	URL     string
+	Client  *http.Client  // If nil, http.DefaultClient is used
+	Timeout time.Duration // If zero, DefaultHookTimeout is used
+}
+
+// Notify POSTs the Advancement, returning an error unless the response status
+// is 2xx. The request is abandoned if it has not completed within the timeout.
+func (h WebhookHook) Notify(ctx context.Context, a Advancement) error {
+	ctx, cancel := context.WithTimeout(ctx, hookTimeout(h.Timeout))
+	defer cancel()
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("POST %v: %v", h.URL, resp.Status)
+	}
+	return nil
+}
+
+// hookTimeout returns the timeout to use for a Hook configured with timeout.
+func hookTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return DefaultHookTimeout
+	}
+	return timeout
+}
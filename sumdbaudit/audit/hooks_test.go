@@ -0,0 +1,93 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+	"time"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func testAdvancement() Advancement {
+	return NewAdvancement(
+		&Checkpoint{Tree: tlog.Tree{N: 5}},
+		&Checkpoint{Tree: tlog.Tree{N: 10}, Raw: []byte("go.sum database tree\n10\n")},
+	)
+}
+
+func TestCommandHook(t *testing.T) {
+	for _, bin := range []string{"sh", "grep", "sleep"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s is not available: %v", bin, err)
+		}
+	}
+	ctx := context.Background()
+	ok := CommandHook{Command: `test "$SUMDB_OLD_SIZE" = 5 && test "$SUMDB_NEW_SIZE" = 10 && grep -q "^10$"`}
+	if err := ok.Notify(ctx, testAdvancement()); err != nil {
+		t.Errorf("Notify: %v", err)
+	}
+	fail := CommandHook{Command: "exit 1"}
+	if err := fail.Notify(ctx, testAdvancement()); err == nil {
+		t.Error("expected error from failing command")
+	}
+	slow := CommandHook{Command: "exec sleep 10", Timeout: 100 * time.Millisecond}
+	start := time.Now()
+	if err := slow.Notify(ctx, testAdvancement()); err == nil {
+		t.Error("expected error from command which timed out")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("command was not killed after its timeout; took %v", elapsed)
+	}
+}
+
+func TestWebhookHook(t *testing.T) {
+	var got Advancement
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+			return
+		}
+		if r.Method != http.MethodPost || r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	want := testAdvancement()
+	if err := (WebhookHook{URL: ts.URL}).Notify(context.Background(), want); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if err := (WebhookHook{URL: ts.URL + "/fail"}).Notify(context.Background(), want); err == nil {
+		t.Error("expected error from failing webhook")
+	}
+	if err := (WebhookHook{URL: ts.URL + "/slow", Timeout: 100 * time.Millisecond}).Notify(context.Background(), want); err == nil {
+		t.Error("expected error from webhook which timed out")
+	}
+}
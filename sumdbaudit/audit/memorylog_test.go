@@ -0,0 +1,119 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// memoryLog is a tlog of the given leaves, along with a client which serves
+// its tiles. The tiles for every tree size are served, including partial tiles,
+// so that any prefix of the log can be cloned or proven.
+type memoryLog struct {
+	leaves []string
+	hashes tlog.HashReaderFunc
+	signer note.Signer
+	values map[string]string
+	client *SumDBClient
+}
+
+func newMemoryLog(t *testing.T, leaves []string) *memoryLog {
+	t.Helper()
+	skey, vkey, err := note.GenerateKey(rand.Reader, "sumdb.example.com")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	var stored []tlog.Hash
+	m := &memoryLog{
+		leaves: leaves,
+		hashes: func(indexes []int64) ([]tlog.Hash, error) {
+			r := make([]tlog.Hash, len(indexes))
+			for i, x := range indexes {
+				r[i] = stored[x]
+			}
+			return r, nil
+		},
+		signer: signer,
+		values: make(map[string]string),
+	}
+	for i, l := range leaves {
+		hs, err := tlog.StoredHashes(int64(i), []byte(l), m.hashes)
+		if err != nil {
+			t.Fatalf("StoredHashes: %v", err)
+		}
+		stored = append(stored, hs...)
+	}
+	for n := int64(1); n <= int64(len(leaves)); n++ {
+		for _, tile := range tlog.NewTiles(2, n-1, n) {
+			data, err := tlog.ReadTileData(tile, m.hashes)
+			if err != nil {
+				t.Fatalf("ReadTileData(%s): %v", tile.Path(), err)
+			}
+			m.values["/"+tile.Path()] = string(data)
+			if tile.L == 0 {
+				start := tile.N << uint(tile.H)
+				tile.L = -1
+				m.values["/"+tile.Path()] = strings.Join(leaves[start:start+int64(tile.W)], "\n")
+			}
+		}
+	}
+	m.client = &SumDBClient{height: 2, vkeys: []string{vkey}, fetcher: &FakeFetcher{values: m.values}}
+	return m
+}
+
+// checkpoint returns the Checkpoint for the first size leaves, signed by the
+// key of this log.
+func (m *memoryLog) checkpoint(t *testing.T, size int64) *Checkpoint {
+	t.Helper()
+	hash, err := tlog.TreeHash(size, m.hashes)
+	if err != nil {
+		t.Fatalf("TreeHash(%d): %v", size, err)
+	}
+	tree := tlog.Tree{N: size, Hash: hash}
+	raw, err := note.Sign(&note.Note{Text: string(tlog.FormatTree(tree))}, m.signer)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return &Checkpoint{Tree: tree, Raw: raw, VerifierKey: m.client.vkeys[0]}
+}
+
+// setLatest makes the log serve the Checkpoint for the first size leaves as
+// the latest.
+func (m *memoryLog) setLatest(t *testing.T, size int64) *Checkpoint {
+	t.Helper()
+	cp := m.checkpoint(t, size)
+	m.values["/latest"] = string(cp.Raw)
+	return cp
+}
+
+// moduleLeaves returns count leaves in the format used by the SumDB, each
+// recording a different module version.
+func moduleLeaves(count int) []string {
+	var leaves []string
+	for i := 0; i < count; i++ {
+		leaves = append(leaves, fmt.Sprintf("example.com/m%d v1.0.%d h1:repo%d=\nexample.com/m%d v1.0.%d/go.mod h1:mod%d=\n", i%3, i, i, i%3, i, i))
+	}
+	return leaves
+}
@@ -0,0 +1,227 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// migration is a versioned change to the database schema. Statements may use
+// $BLOB and $INT for column types which differ between database drivers.
+// Reverting a migration must never lose data, so down statements only undo
+// changes that older code cannot work with; anything else, such as a new table,
+// is left in place. Up statements must therefore succeed if the change has
+// already been made.
+type migration struct {
+	up      []string // Statements to apply the change
+	down    []string // Statements to revert the change, if any are needed
+	columns []column // Columns to add to existing tables, if not already present
+}
+
+// column is a nullable column added to an existing table by a migration. Not
+// every database can add a column only if it does not exist, so this is checked
+// before it is added.
+type column struct {
+	table, name, typ string
+}
+
+// migrations is the history of the database schema. The schema version is the
+// number of migrations that have been applied. New migrations must only ever
+// be appended to this list.
+var migrations = []migration{
+	{
+		// The original schema. This existed before versioning, so creation is
+		// conditional in order to adopt databases created by older versions.
+		up: []string{
+			"CREATE TABLE IF NOT EXISTS leaves (id $INT PRIMARY KEY, data $BLOB)",
+			`CREATE TABLE IF NOT EXISTS tiles (height INTEGER, level INTEGER, "offset" $INT, hashes $BLOB, PRIMARY KEY (height, level, "offset"))`,
+			"CREATE TABLE IF NOT EXISTS leafMetadata (id $INT PRIMARY KEY, module TEXT, version TEXT, repohash TEXT, modhash TEXT)",
+		},
+	},
+	{
+		// Verified checkpoints, also created before versioning.
+		up: []string{
+			"CREATE TABLE IF NOT EXISTS checkpoints (datetime TIMESTAMP PRIMARY KEY, size $INT, hash $BLOB, raw $BLOB)",
+		},
+	},
+	{
+		// Supports looking up leaves and finding duplicates by module version.
+		up: []string{
+			"CREATE INDEX IF NOT EXISTS leafMetadataModuleVersion ON leafMetadata (module, version)",
+		},
+		down: []string{
+			"DROP INDEX IF EXISTS leafMetadataModuleVersion",
+		},
+	},
+	{
+		// Evidence of split views found by comparing SumDB endpoints.
+		up: []string{
+			"CREATE TABLE IF NOT EXISTS splitViews (datetime TIMESTAMP PRIMARY KEY, rawA $BLOB, rawB $BLOB, reason TEXT)",
+		},
+	},
+	{
+		// Records the key which each verified checkpoint was signed by. This is
+		// null for checkpoints verified before the key was recorded.
+		columns: []column{
+			{table: "checkpoints", name: "vkey", typ: "TEXT"},
+		},
+	},
+}
+
+// schemaLockID identifies the Postgres advisory lock taken while migrating.
+const schemaLockID = 0x73756d6462
+
+// SchemaVersion returns the version of the database schema, which is 0 if no
+// migrations have been applied. The database is not modified.
+func (d *Database) SchemaVersion() (int, error) {
+	query := "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='schemaVersion'"
+	if d.driver == DriverPostgres {
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema=current_schema() AND table_name='schemaversion'"
+	}
+	var tables int
+	if err := d.db.QueryRow(query).Scan(&tables); err != nil {
+		return 0, err
+	}
+	if tables == 0 {
+		return 0, nil
+	}
+	return schemaVersion(d.db.QueryRow("SELECT version FROM schemaVersion"))
+}
+
+// schemaVersion scans the version from a query of the schemaVersion table.
+func schemaVersion(row *sql.Row) (int, error) {
+	var version int
+	err := row.Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return version, err
+}
+
+// Migrate applies or reverts migrations until the database schema is at the
+// given version. All of the migrations are applied in a single transaction,
+// which holds a lock on the schema so that concurrent calls are serialized. If
+// an error occurs the schema is left unchanged.
+func (d *Database) Migrate(version int) error {
+	if version < 0 || version > len(migrations) {
+		return fmt.Errorf("schema version %d is unknown; latest is %d", version, len(migrations))
+	}
+	if d.driver == DriverSQLite {
+		// SQLite serializes this with any concurrent creation of the table, which
+		// Postgres does not, so for Postgres it is created under the lock.
+		if _, err := d.db.Exec("CREATE TABLE IF NOT EXISTS schemaVersion (version INTEGER)"); err != nil {
+			return err
+		}
+	}
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("BeginTx: %v", err)
+	}
+	if err := d.migrate(tx, version); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrate locks the schema and then applies or reverts migrations within tx.
+func (d *Database) migrate(tx *sql.Tx, version int) error {
+	if d.driver == DriverPostgres {
+		if _, err := tx.Exec(fmt.Sprintf("SELECT pg_advisory_xact_lock(%d)", schemaLockID)); err != nil {
+			return fmt.Errorf("failed to lock schema: %v", err)
+		}
+		if _, err := tx.Exec("CREATE TABLE IF NOT EXISTS schemaVersion (version INTEGER)"); err != nil {
+			return err
+		}
+	} else {
+		// Writing first means that SQLite waits for the database lock, rather
+		// than failing when upgrading a read lock later in the transaction.
+		if _, err := tx.Exec("UPDATE schemaVersion SET version=version"); err != nil {
+			return fmt.Errorf("failed to lock schema: %v", err)
+		}
+	}
+
+	current, err := schemaVersion(tx.QueryRow("SELECT version FROM schemaVersion"))
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %v", err)
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than this code supports (%d)", current, len(migrations))
+	}
+	for ; current < version; current++ {
+		if err := d.exec(tx, migrations[current].up); err != nil {
+			return fmt.Errorf("failed to migrate to schema version %d: %v", current+1, err)
+		}
+		for _, c := range migrations[current].columns {
+			if err := d.addColumn(tx, c); err != nil {
+				return fmt.Errorf("failed to migrate to schema version %d: %v", current+1, err)
+			}
+		}
+	}
+	for ; current > version; current-- {
+		if err := d.exec(tx, migrations[current-1].down); err != nil {
+			return fmt.Errorf("failed to revert to schema version %d: %v", current-1, err)
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM schemaVersion"); err != nil {
+		return err
+	}
+	_, err = tx.Exec(d.rebind("INSERT INTO schemaVersion (version) VALUES (?)"), version)
+	return err
+}
+
+// exec runs the migration statements within tx.
+func (d *Database) exec(tx *sql.Tx, statements []string) error {
+	for _, stmt := range statements {
+		if _, err := tx.Exec(d.ddl(stmt)); err != nil {
+			return fmt.Errorf("%q: %v", stmt, err)
+		}
+	}
+	return nil
+}
+
+// addColumn adds the column within tx, unless the table already has it.
+func (d *Database) addColumn(tx *sql.Tx, c column) error {
+	query := "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name=?"
+	if d.driver == DriverPostgres {
+		// Postgres folds unquoted identifiers to lower case.
+		query = "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema=current_schema() AND table_name=LOWER(?) AND column_name=LOWER(?)"
+	}
+	var found int
+	if err := tx.QueryRow(d.rebind(query), c.table, c.name).Scan(&found); err != nil {
+		return fmt.Errorf("failed to find column %s.%s: %v", c.table, c.name, err)
+	}
+	if found > 0 {
+		return nil
+	}
+	stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.name, c.typ)
+	if _, err := tx.Exec(d.ddl(stmt)); err != nil {
+		return fmt.Errorf("%q: %v", stmt, err)
+	}
+	return nil
+}
+
+// ddl replaces the column type placeholders in a migration statement with the
+// types for the database driver.
+func (d *Database) ddl(stmt string) string {
+	blob, integer := "BLOB", "INTEGER"
+	if d.driver == DriverPostgres {
+		blob, integer = "BYTEA", "BIGINT"
+	}
+	return strings.NewReplacer("$BLOB", blob, "$INT", integer).Replace(stmt)
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestMigrations(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, d *Database) {
+		if v, err := d.SchemaVersion(); err != nil || v != 0 {
+			t.Fatalf("SchemaVersion of new database: got (%d, %v), want (0, nil)", v, err)
+		}
+		if _, err := d.db.Exec("SELECT version FROM schemaVersion"); err == nil {
+			t.Fatal("SchemaVersion created the schemaVersion table")
+		}
+
+		latest := len(migrations)
+		checkVersion := func(want int) {
+			t.Helper()
+			if got, err := d.SchemaVersion(); err != nil || got != want {
+				t.Fatalf("SchemaVersion: got (%d, %v), want (%d, nil)", got, err, want)
+			}
+		}
+		if err := d.Init(); err != nil {
+			t.Fatalf("Init: %v", err)
+		}
+		checkVersion(latest)
+
+		cp := &Checkpoint{Tree: tlog.Tree{N: 1}, Raw: []byte("checkpoint"), VerifierKey: "sumdb.example.com+01234567+AQ"}
+		if err := d.WriteLeaves(context.Background(), 0, [][]byte{[]byte("leaf")}); err != nil {
+			t.Fatalf("WriteLeaves: %v", err)
+		}
+		if err := d.SetLeafMetadata(context.Background(), 0, []Metadata{{Module: "example.com/m", Version: "v1.0.0"}}); err != nil {
+			t.Fatalf("SetLeafMetadata: %v", err)
+		}
+		if err := d.SetGoldenCheckpoint(cp); err != nil {
+			t.Fatalf("SetGoldenCheckpoint: %v", err)
+		}
+		if err := d.RecordSplitView(&SplitView{A: cp, B: cp, Reason: "test"}); err != nil {
+			t.Fatalf("RecordSplitView: %v", err)
+		}
+
+		// Reverting every migration and then applying them again must not lose
+		// any data, and applying them when up to date must do nothing.
+		if err := d.Migrate(0); err != nil {
+			t.Fatalf("Migrate(0): %v", err)
+		}
+		checkVersion(0)
+		for i := 0; i < 2; i++ {
+			if err := d.Init(); err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+			checkVersion(latest)
+		}
+
+		for _, table := range []string{"leaves", "leafMetadata", "checkpoints", "splitViews"} {
+			var count int
+			if err := d.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+				t.Fatalf("failed to count %s: %v", table, err)
+			}
+			if count != 1 {
+				t.Errorf("got %d rows in %s, want 1", count, table)
+			}
+		}
+		cps, err := d.VerifiedCheckpoints()
+		if err != nil {
+			t.Fatalf("VerifiedCheckpoints: %v", err)
+		}
+		if len(cps) != 1 || cps[0].VerifierKey != cp.VerifierKey {
+			t.Errorf("got checkpoints %+v, want one with key %q", cps, cp.VerifierKey)
+		}
+
+		if err := d.Migrate(latest + 1); err == nil {
+			t.Error("expected error migrating to unknown version")
+		}
+	})
+}
+
+func TestMigrateConcurrent(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, d *Database) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 8)
+		for i := 0; i < cap(errs); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- d.Init()
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Errorf("Init: %v", err)
+			}
+		}
+		if got, err := d.SchemaVersion(); err != nil || got != len(migrations) {
+			t.Errorf("SchemaVersion: got (%d, %v), want (%d, nil)", got, err, len(migrations))
+		}
+	})
+}
+
+func TestDDL(t *testing.T) {
+	stmt := "CREATE TABLE t (id $INT PRIMARY KEY, data $BLOB)"
+	for driver, want := range map[string]string{
+		DriverSQLite:   "CREATE TABLE t (id INTEGER PRIMARY KEY, data BLOB)",
+		DriverPostgres: "CREATE TABLE t (id BIGINT PRIMARY KEY, data BYTEA)",
+	} {
+		d := &Database{driver: driver}
+		if got := d.ddl(stmt); got != want {
+			t.Errorf("%s: got %q, want %q", driver, got, want)
+		}
+	}
+}
+
+func TestMigrateCheckpointVerifierKey(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, d *Database) {
+		// Checkpoints written before their keys were recorded.
+		if err := d.Migrate(4); err != nil {
+			t.Fatalf("Migrate(4): %v", err)
+		}
+		if _, err := d.db.Exec("SELECT vkey FROM checkpoints"); err == nil {
+			t.Fatal("checkpoints has vkey column before its migration")
+		}
+		old := time.Now().Add(-time.Hour)
+		if _, err := d.db.Exec(d.rebind("INSERT INTO checkpoints (datetime, size, hash, raw) VALUES (?, ?, ?, ?)"), old, 1, make([]byte, HashLenBytes), []byte("old")); err != nil {
+			t.Fatalf("failed to write checkpoint: %v", err)
+		}
+
+		if err := d.Migrate(5); err != nil {
+			t.Fatalf("Migrate(5): %v", err)
+		}
+		vkey := "sumdb.example.com+01234567+AQ"
+		if err := d.SetGoldenCheckpoint(&Checkpoint{Tree: tlog.Tree{N: 2}, Raw: []byte("new"), VerifierKey: vkey}); err != nil {
+			t.Fatalf("SetGoldenCheckpoint: %v", err)
+		}
+		checkKeys := func() {
+			t.Helper()
+			cps, err := d.VerifiedCheckpoints()
+			if err != nil {
+				t.Fatalf("VerifiedCheckpoints: %v", err)
+			}
+			if len(cps) != 2 || cps[0].VerifierKey != "" || cps[1].VerifierKey != vkey {
+				t.Errorf("got checkpoints %+v, want keys %q and %q", cps, "", vkey)
+			}
+		}
+		checkKeys()
+
+		// Reverting the migration leaves the keys in place for when it is
+		// applied again.
+		if err := d.Migrate(4); err != nil {
+			t.Fatalf("Migrate(4): %v", err)
+		}
+		if err := d.Migrate(5); err != nil {
+			t.Fatalf("Migrate(5): %v", err)
+		}
+		checkKeys()
+	})
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Progress is a snapshot of how far through a long-running operation the
+// Service is. Done and Total count leaves when cloning, and tiles otherwise.
+type Progress struct {
+	Stage   string        `json:"stage"` // Empty if no operation has started
+	Level   int           `json:"level"`
+	Offset  int           `json:"offset"`
+	Done    int64         `json:"done"`
+	Total   int64         `json:"total"`
+	Rate    float64       `json:"rate"` // Done per second since the stage started
+	ETA     time.Duration `json:"eta"`  // Zero if the rate is not yet known
+	Started time.Time     `json:"started"`
+}
+
+func (p Progress) String() string {
+	if len(p.Stage) == 0 {
+		return "idle"
+	}
+	if p.Total == 0 {
+		return fmt.Sprintf("%s: nothing to do", p.Stage)
+	}
+	s := fmt.Sprintf("%s: %d/%d (%.1f%%) at L=%d, O=%d, %.1f/s", p.Stage, p.Done, p.Total, 100*float64(p.Done)/float64(p.Total), p.Level, p.Offset, p.Rate)
+	if p.ETA > 0 {
+		s += fmt.Sprintf(", ETA %v", p.ETA.Round(time.Second))
+	}
+	return s
+}
+
+// progressTracker records Progress as it is reported from any goroutine.
+type progressTracker struct {
+	mu  sync.Mutex
+	p   Progress
+	now func() time.Time
+}
+
+// start begins a new stage, which will be complete once total has been done.
+func (t *progressTracker) start(stage string, total int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.p = Progress{Stage: stage, Total: total, Started: t.now()}
+}
+
+// update records that n more have been done, and the position reached.
+func (t *progressTracker) update(level, offset int, n int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.p.Level, t.p.Offset = level, offset
+	t.p.Done += n
+}
+
+// get returns a snapshot of the current Progress.
+func (t *progressTracker) get() Progress {
+	t.mu.Lock()
+	p := t.p
+	t.mu.Unlock()
+	if elapsed := t.now().Sub(p.Started).Seconds(); elapsed > 0 && p.Done > 0 {
+		p.Rate = float64(p.Done) / elapsed
+		p.ETA = time.Duration(float64(p.Total-p.Done) / p.Rate * float64(time.Second))
+	}
+	return p
+}
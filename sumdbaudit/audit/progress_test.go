@@ -0,0 +1,53 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgressTracker(t *testing.T) {
+	now := time.Date(2020, 8, 1, 12, 0, 0, 0, time.UTC)
+	pt := progressTracker{now: func() time.Time { return now }}
+
+	if got, want := pt.get().String(), "idle"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	pt.start("clone leaves", 1000)
+	now = now.Add(10 * time.Second)
+	pt.update(0, 0, 256)
+	pt.update(0, 1, 144)
+
+	p := pt.get()
+	if got, want := p.Done, int64(400); got != want {
+		t.Errorf("Done got %d, want %d", got, want)
+	}
+	if got, want := p.Rate, 40.0; got != want {
+		t.Errorf("Rate got %v, want %v", got, want)
+	}
+	if got, want := p.ETA, 15*time.Second; got != want {
+		t.Errorf("ETA got %v, want %v", got, want)
+	}
+	if got, want := p.String(), "clone leaves: 400/1000 (40.0%) at L=0, O=1, 40.0/s, ETA 15s"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	pt.start("hash tiles", 4)
+	if got, want := pt.get().Done, int64(0); got != want {
+		t.Errorf("Done after new stage got %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"fmt"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// InclusionProof calculates a proof that the leaf at index is committed to by
+// the checkpoint, using only the data in the local database. The tiles used
+// are checked against the checkpoint as they are read.
+func (s *Service) InclusionProof(checkpoint *tlog.Tree, index int64) (tlog.RecordProof, error) {
+	if index < 0 || index >= checkpoint.N {
+		return nil, fmt.Errorf("leaf index %d is outside of tree size %d", index, checkpoint.N)
+	}
+	return tlog.ProveRecord(checkpoint.N, index, tlog.TileHashReader(*checkpoint, &localTileReader{s: s}))
+}
+
+// CheckConsistency checks that the older checkpoint is consistent with the
+// newer one, i.e. that the log has only been appended to in between them. The
+// proof is calculated from the local database, which must have been verified
+// against the newer checkpoint. An IntegrityError is returned if the
+// checkpoints are inconsistent.
+func (s *Service) CheckConsistency(older, newer *tlog.Tree) error {
+	if newer.N < older.N {
+		return &IntegrityError{Err: fmt.Errorf("tree size %d is smaller than previously verified tree size %d", newer.N, older.N)}
+	}
+	if older.N == 0 {
+		return nil
+	}
+	proof, err := tlog.ProveTree(newer.N, older.N, tlog.TileHashReader(*newer, &localTileReader{s: s}))
+	if err != nil {
+		return fmt.Errorf("failed to calculate consistency proof: %v", err)
+	}
+	if err := tlog.CheckTree(proof, newer.N, newer.Hash, older.N, older.Hash); err != nil {
+		return &IntegrityError{Err: fmt.Errorf("tree size %d with hash %s is inconsistent with tree size %d with hash %s: %v", older.N, older.Hash, newer.N, newer.Hash, err)}
+	}
+	return nil
+}
+
+// CheckSumDBConsistency checks that the latest checkpoint served by the SumDB
+// is consistent with a trusted one, such as the golden checkpoint or one pinned
+// by the user, before any of its leaves have been cloned. The proof is
+// calculated from the tiles served by the SumDB. As the SumDB must never serve
+// a tree smaller than one it has already signed, an IntegrityError is returned
+// if the latest checkpoint is smaller than the trusted one, as well as if the
+// two are inconsistent.
+func (s *Service) CheckSumDBConsistency(trusted, latest *Checkpoint) error {
+	if latest.N < trusted.N {
+		return &IntegrityError{Err: fmt.Errorf("SumDB tree size %d is smaller than trusted tree size %d", latest.N, trusted.N)}
+	}
+	split, err := CompareCheckpoints(trusted, latest, s.sumDB, s.sumDB)
+	if err != nil {
+		return err
+	}
+	if split != nil {
+		return &IntegrityError{Err: fmt.Errorf("SumDB is inconsistent with trusted checkpoint: %v", split)}
+	}
+	return nil
+}
+
+// TileData gets the data for the given tile, in the same format as served by
+// the SumDB, using only the data in the local database. Data tiles are given
+// by a Tile with L of -1, as with tlog.ParseTilePath. Partial tiles are
+// calculated as needed. The caller must ensure that the tile is within the
+// range of leaves which have been cloned.
+func (s *Service) TileData(t tlog.Tile) ([]byte, error) {
+	if t.L >= 0 {
+		data, err := (&localTileReader{s: s}).ReadTiles([]tlog.Tile{t})
+		if err != nil {
+			return nil, err
+		}
+		return data[0], nil
+	}
+	if t.H != s.height {
+		return nil, fmt.Errorf("tile height %d does not match local height %d", t.H, s.height)
+	}
+	leaves, err := s.Leaves(t.N<<uint(t.H), t.W)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get leaves for tile %s: %v", t.Path(), err)
+	}
+	return bytes.Join(leaves, []byte("\n")), nil
+}
+
+// localTileReader implements tlog.TileReader using the tiles and leaves in the
+// local database. Only complete tiles are stored locally, so any partial tiles
+// needed are calculated from the stragglers or the tiles beneath them.
+type localTileReader struct {
+	s *Service
+}
+
+// Height returns the height of the available tiles.
+func (r *localTileReader) Height() int {
+	return r.s.height
+}
+
+// ReadTiles returns the data for each requested tile.
+func (r *localTileReader) ReadTiles(tiles []tlog.Tile) ([][]byte, error) {
+	data := make([][]byte, len(tiles))
+	for i, t := range tiles {
+		hashes, err := r.tileHashes(t)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tile %v: %v", t.Path(), err)
+		}
+		data[i] = make([]byte, 0, len(hashes)*HashLenBytes)
+		for _, h := range hashes {
+			data[i] = append(data[i], h...)
+		}
+	}
+	return data, nil
+}
+
+// SaveTiles does nothing; all complete tiles are already stored locally.
+func (r *localTileReader) SaveTiles(tiles []tlog.Tile, data [][]byte) {}
+
+func (r *localTileReader) tileHashes(t tlog.Tile) ([][]byte, error) {
+	s := r.s
+	tileWidth := 1 << s.height
+	if t.H != s.height {
+		return nil, fmt.Errorf("tile height %d does not match local height %d", t.H, s.height)
+	}
+	if t.W == tileWidth {
+		return s.localDB.Tile(s.height, t.L, int(t.N))
+	}
+	if t.L == 0 {
+		leaves, err := s.Leaves(t.N*int64(tileWidth), t.W)
+		if err != nil {
+			return nil, err
+		}
+		res := make([][]byte, len(leaves))
+		for i, l := range leaves {
+			h := tlog.RecordHash(l)
+			res[i] = h[:]
+		}
+		return res, nil
+	}
+	// Each hash in a partial tile is the root of a complete tile beneath it.
+	res := make([][]byte, t.W)
+	for i := range res {
+		lower, err := s.localDB.Tile(s.height, t.L-1, int(t.N)*tileWidth+i)
+		if err != nil {
+			return nil, err
+		}
+		if res[i], err = s.tileRoot(lower); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestInclusionProof(t *testing.T) {
+	d, cleanup := newTestDatabase(t)
+	defer cleanup()
+	m := newMemoryLog(t, moduleLeaves(19))
+	s := NewService(d, m.client, 2)
+	clone(t, s, m, 19)
+
+	// Checkpoints smaller than the clone need partial tiles to be derived.
+	for _, size := range []int64{1, 6, 16, 19} {
+		cp := m.checkpoint(t, size)
+		for i := int64(0); i < size; i++ {
+			proof, err := s.InclusionProof(&cp.Tree, i)
+			if err != nil {
+				t.Fatalf("InclusionProof(%d, %d): %v", size, i, err)
+			}
+			if err := tlog.CheckRecord(proof, cp.N, cp.Hash, i, tlog.RecordHash([]byte(m.leaves[i]))); err != nil {
+				t.Errorf("CheckRecord(%d, %d): %v", size, i, err)
+			}
+		}
+		for _, i := range []int64{-1, size} {
+			if _, err := s.InclusionProof(&cp.Tree, i); err == nil {
+				t.Errorf("InclusionProof(%d, %d): expected error for index outside tree", size, i)
+			}
+		}
+	}
+}
+
+func TestCheckConsistency(t *testing.T) {
+	d, cleanup := newTestDatabase(t)
+	defer cleanup()
+	m := newMemoryLog(t, moduleLeaves(19))
+	s := NewService(d, m.client, 2)
+	clone(t, s, m, 19)
+
+	for _, test := range []struct {
+		name         string
+		older, newer int64
+		corruptHash  bool
+		wantErr      bool
+	}{
+		{name: "empty", older: 0, newer: 19},
+		{name: "single leaf", older: 1, newer: 19},
+		{name: "partial tile", older: 6, newer: 19},
+		{name: "tile boundary", older: 16, newer: 19},
+		{name: "same", older: 19, newer: 19},
+		{name: "both smaller than clone", older: 5, newer: 11},
+		{name: "older larger", older: 19, newer: 11, wantErr: true},
+		{name: "wrong hash", older: 11, newer: 19, corruptHash: true, wantErr: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			older, newer := m.checkpoint(t, test.older), m.checkpoint(t, test.newer)
+			if test.corruptHash {
+				older.Hash[0] ^= 1
+			}
+			err := s.CheckConsistency(&older.Tree, &newer.Tree)
+			var ie *IntegrityError
+			if gotErr := errors.As(err, &ie); gotErr != test.wantErr {
+				t.Errorf("got error %v, want IntegrityError %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckSumDBConsistency(t *testing.T) {
+	leaves := moduleLeaves(19)
+	forked := append([]string(nil), leaves...)
+	forked[3] = "example.com/forked v1.0.0 h1:repo=\nexample.com/forked v1.0.0/go.mod h1:mod=\n"
+	good, bad := newMemoryLog(t, leaves), newMemoryLog(t, forked)
+
+	for _, test := range []struct {
+		name          string
+		log           *memoryLog // The log served by the SumDB
+		trusted       int64
+		latest        int64
+		missingTiles  bool
+		wantErr       bool
+		wantIntegrity bool
+	}{
+		{name: "empty", log: good, trusted: 0, latest: 19},
+		{name: "same", log: good, trusted: 11, latest: 11},
+		{name: "grown", log: good, trusted: 6, latest: 19},
+		{name: "smaller", log: good, trusted: 19, latest: 11, wantErr: true, wantIntegrity: true},
+		{name: "fork", log: bad, trusted: 6, latest: 19, wantErr: true, wantIntegrity: true},
+		{name: "before fork", log: bad, trusted: 3, latest: 19},
+		{name: "tiles unavailable", log: good, trusted: 6, latest: 19, missingTiles: true, wantErr: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client := test.log.client
+			if test.missingTiles {
+				client = &SumDBClient{height: 2, fetcher: &FakeFetcher{values: map[string]string{}}}
+			}
+			s := NewService(nil, client, 2)
+			trusted, latest := good.checkpoint(t, test.trusted), test.log.checkpoint(t, test.latest)
+			err := s.CheckSumDBConsistency(trusted, latest)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("got error %v, want error %t", err, test.wantErr)
+			}
+			var ie *IntegrityError
+			if got := errors.As(err, &ie); got != test.wantIntegrity {
+				t.Errorf("got error %v, want IntegrityError %t", err, test.wantIntegrity)
+			}
+		})
+	}
+}
+
+func TestLocalTileReader(t *testing.T) {
+	d, cleanup := newTestDatabase(t)
+	defer cleanup()
+	m := newMemoryLog(t, moduleLeaves(19))
+	s := NewService(d, m.client, 2)
+	clone(t, s, m, 19)
+
+	r := &localTileReader{s: s}
+	if got, want := r.Height(), 2; got != want {
+		t.Errorf("got height %d, want %d", got, want)
+	}
+	// Every tile for every tree size, which includes partial tiles at each level.
+	for n := int64(1); n <= 19; n++ {
+		tiles := tlog.NewTiles(2, n-1, n)
+		data, err := r.ReadTiles(tiles)
+		if err != nil {
+			t.Fatalf("ReadTiles(%d): %v", n, err)
+		}
+		for i, tile := range tiles {
+			want, err := tlog.ReadTileData(tile, m.hashes)
+			if err != nil {
+				t.Fatalf("ReadTileData(%s): %v", tile.Path(), err)
+			}
+			if !bytes.Equal(data[i], want) {
+				t.Errorf("tile %s: got %x, want %x", tile.Path(), data[i], want)
+			}
+		}
+	}
+
+	if _, err := r.ReadTiles([]tlog.Tile{{H: 3, L: 0, N: 0, W: 8}}); err == nil {
+		t.Error("expected error reading tile of the wrong height")
+	}
+}
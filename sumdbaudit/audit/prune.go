@@ -0,0 +1,83 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"fmt"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// PruneLeaves drops the raw leaf data for all complete tiles in the checkpoint,
+// other than those containing the most recent retain leaves. The tiles and leaf
+// metadata are kept, so the clone can still be verified and queried, and any
+// leaf data which is needed later is fetched from the SumDB again. HashTiles,
+// CheckRootHash and ProcessMetadata must have succeeded for the checkpoint.
+func (s *Service) PruneLeaves(checkpoint *tlog.Tree, retain int64) error {
+	tileWidth := int64(1 << s.height)
+	end := (checkpoint.N - retain) / tileWidth * tileWidth
+	if end <= 0 {
+		return nil
+	}
+	return s.localDB.PruneLeaves(end)
+}
+
+// Leaves gets the data for count leaves from start, which must all be within
+// the same tile. If the data has been pruned, the tile is fetched from the
+// SumDB again and checked against the tile hashes in the local database.
+func (s *Service) Leaves(start int64, count int) ([][]byte, error) {
+	leaves, err := s.localDB.Leaves(start, count)
+	if err != nil {
+		return nil, err
+	}
+	if !pruned(leaves) {
+		return leaves, nil
+	}
+
+	tileWidth := int64(1 << s.height)
+	offset := int(start / tileWidth)
+	if end := start + int64(count); end > int64(offset+1)*tileWidth {
+		return nil, fmt.Errorf("pruned leaves [%d, %d) span more than one tile", start, end)
+	}
+	hashes, err := s.localDB.Tile(s.height, 0, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tile for pruned leaves at L=0, O=%d: %v", offset, err)
+	}
+	fetched, err := s.sumDB.FullLeavesAtOffset(offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch pruned leaves at offset %d: %v", offset, err)
+	}
+	if got, want := len(fetched), len(hashes); got != want {
+		return nil, fmt.Errorf("fetched %d pruned leaves at offset %d, expected %d", got, offset, want)
+	}
+	for i, l := range fetched {
+		if h := tlog.RecordHash(l); !bytes.Equal(h[:], hashes[i]) {
+			return nil, fmt.Errorf("fetched leaf %d does not match local tile hash", int64(offset)*tileWidth+int64(i))
+		}
+	}
+	first := int(start - int64(offset)*tileWidth)
+	return fetched[first : first+count], nil
+}
+
+// pruned returns true if the data for any of the leaves has been pruned.
+func pruned(leaves [][]byte) bool {
+	for _, l := range leaves {
+		if l == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPruneLeaves(t *testing.T) {
+	for _, test := range []struct {
+		retain     int64
+		wantPruned int64 // Leaves before this index are pruned
+	}{
+		{retain: 0, wantPruned: 16},
+		{retain: 3, wantPruned: 16},
+		// Only whole tiles are pruned, so rounding down keeps more than retain.
+		{retain: 4, wantPruned: 12},
+		{retain: 5, wantPruned: 12},
+		{retain: 15, wantPruned: 4},
+		{retain: 16, wantPruned: 0},
+		{retain: 100, wantPruned: 0},
+	} {
+		t.Run(fmt.Sprintf("retain %d", test.retain), func(t *testing.T) {
+			d, cleanup := newTestDatabase(t)
+			defer cleanup()
+			m := newMemoryLog(t, moduleLeaves(19))
+			s := NewService(d, m.client, 2)
+			cp := clone(t, s, m, 19)
+
+			if err := s.PruneLeaves(&cp.Tree, test.retain); err != nil {
+				t.Fatalf("PruneLeaves: %v", err)
+			}
+			leaves, err := d.Leaves(0, 19)
+			if err != nil {
+				t.Fatalf("Leaves: %v", err)
+			}
+			for i, l := range leaves {
+				if got, want := l == nil, int64(i) < test.wantPruned; got != want {
+					t.Errorf("leaf %d pruned is %t, want %t", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLeavesRefetch(t *testing.T) {
+	d, cleanup := newTestDatabase(t)
+	defer cleanup()
+	m := newMemoryLog(t, moduleLeaves(19))
+	s := NewService(d, m.client, 2)
+	cp := clone(t, s, m, 19)
+	if err := s.PruneLeaves(&cp.Tree, 0); err != nil {
+		t.Fatalf("PruneLeaves: %v", err)
+	}
+
+	// The pruned leaves match the local tile hashes when fetched again.
+	got, err := s.Leaves(5, 2)
+	if err != nil {
+		t.Fatalf("Leaves: %v", err)
+	}
+	for i, l := range got {
+		if want := m.leaves[5+i]; string(l) != want {
+			t.Errorf("leaf %d: got %q, want %q", 5+i, l, want)
+		}
+	}
+	if _, err := s.Leaves(6, 4); err == nil {
+		t.Error("expected error for pruned leaves spanning two tiles")
+	}
+
+	// A SumDB which serves different leaves for the tile is caught.
+	tampered := append([]string(nil), m.leaves[4:8]...)
+	tampered[2] = strings.Replace(tampered[2], "h1:repo", "h1:evil", 1)
+	m.values["/tile/2/data/001"] = strings.Join(tampered, "\n")
+	if _, err := s.Leaves(5, 2); err == nil {
+		t.Error("expected error for fetched leaves which do not match the tile hashes")
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// reportHeader is the first line of the text of a signed duplicates report.
+const reportHeader = "sumdbaudit duplicates report"
+
+// Duplicate is a module and version which appears in more than one leaf.
+type Duplicate struct {
+	Module, Version string
+	Leaves          []LeafMetadata
+}
+
+// Conflicting returns true if the leaves for this module and version do not
+// all record the same hashes. This is a violation of the SumDB claim that any
+// module version has a single checksum for all clients.
+func (d Duplicate) Conflicting() bool {
+	for _, l := range d.Leaves[1:] {
+		if l.RepoHash != d.Leaves[0].RepoHash || l.ModHash != d.Leaves[0].ModHash {
+			return true
+		}
+	}
+	return false
+}
+
+// FindDuplicates scans the processed leaf metadata for any module and version
+// which appears in more than one leaf. ProcessMetadata must have been run first.
+func (s *Service) FindDuplicates(ctx context.Context) ([]Duplicate, error) {
+	var dups []Duplicate
+	err := s.localDB.Duplicates(func(m LeafMetadata) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if n := len(dups); n == 0 || dups[n-1].Module != m.Module || dups[n-1].Version != m.Version {
+			dups = append(dups, Duplicate{Module: m.Module, Version: m.Version})
+		}
+		dups[len(dups)-1].Leaves = append(dups[len(dups)-1].Leaves, m)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find duplicates: %v", err)
+	}
+	return dups, nil
+}
+
+// SignedDuplicatesReport creates a report of the duplicates found in the log
+// at the given checkpoint, signed as a note so that the findings of this
+// auditor can be verified by others. Each line after the checkpoint lists one
+// leaf, with a leading '!' for leaves of a module version whose hashes conflict.
+func SignedDuplicatesReport(checkpoint *tlog.Tree, dups []Duplicate, signer note.Signer) ([]byte, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n%d\n%s\n", reportHeader, checkpoint.N, checkpoint.Hash)
+	for _, d := range dups {
+		prefix := " "
+		if d.Conflicting() {
+			prefix = "!"
+		}
+		for _, l := range d.Leaves {
+			fmt.Fprintf(&b, "%s%d %s %s %s %s\n", prefix, l.Index, l.Module, l.Version, l.RepoHash, l.ModHash)
+		}
+	}
+	return note.Sign(&note.Note{Text: b.String()}, signer)
+}
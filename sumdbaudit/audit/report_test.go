@@ -0,0 +1,97 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestConflicting(t *testing.T) {
+	leaf := func(index int64, repoHash string) LeafMetadata {
+		return LeafMetadata{Index: index, Metadata: Metadata{"golang.org/x/mod", "v0.3.0", repoHash, "h1:mod="}}
+	}
+	for _, test := range []struct {
+		name   string
+		leaves []LeafMetadata
+		want   bool
+	}{
+		{
+			name:   "same hashes",
+			leaves: []LeafMetadata{leaf(1, "h1:a="), leaf(5, "h1:a=")},
+			want:   false,
+		},
+		{
+			name:   "different hashes",
+			leaves: []LeafMetadata{leaf(1, "h1:a="), leaf(5, "h1:b=")},
+			want:   true,
+		},
+		{
+			name:   "last differs",
+			leaves: []LeafMetadata{leaf(1, "h1:a="), leaf(5, "h1:a="), leaf(9, "h1:b=")},
+			want:   true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			d := Duplicate{Module: "golang.org/x/mod", Version: "v0.3.0", Leaves: test.leaves}
+			if got := d.Conflicting(); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSignedDuplicatesReport(t *testing.T) {
+	skey, vkey, err := note.GenerateKey(rand.Reader, "auditor.example.com")
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	verifier, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatalf("failed to create verifier: %v", err)
+	}
+
+	dups := []Duplicate{{
+		Module:  "golang.org/x/mod",
+		Version: "v0.3.0",
+		Leaves: []LeafMetadata{
+			{Index: 1, Metadata: Metadata{"golang.org/x/mod", "v0.3.0", "h1:a=", "h1:mod="}},
+			{Index: 5, Metadata: Metadata{"golang.org/x/mod", "v0.3.0", "h1:b=", "h1:mod="}},
+		},
+	}}
+	report, err := SignedDuplicatesReport(&tlog.Tree{N: 10}, dups, signer)
+	if err != nil {
+		t.Fatalf("failed to create report: %v", err)
+	}
+	n, err := note.Open(report, note.VerifierList(verifier))
+	if err != nil {
+		t.Fatalf("failed to verify report: %v", err)
+	}
+	lines := strings.Split(n.Text, "\n")
+	if got, want := lines[0], reportHeader; got != want {
+		t.Errorf("got header %q, want %q", got, want)
+	}
+	if got, want := lines[3], "!1 golang.org/x/mod v0.3.0 h1:a= h1:mod="; got != want {
+		t.Errorf("got line %q, want %q", got, want)
+	}
+}
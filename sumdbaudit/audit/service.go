@@ -25,9 +25,9 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	backoff "github.com/cenkalti/backoff/v4"
-	"github.com/golang/glog"
 	"github.com/google/trillian/merkle/compact"
 	"golang.org/x/mod/sumdb/tlog"
 	"golang.org/x/sync/errgroup"
@@ -40,6 +40,8 @@ type Service struct {
 	sumDB   *SumDBClient
 	rf      *compact.RangeFactory
 	height  int
+
+	progress progressTracker
 }
 
 // NewService constructs a new Service which is ready to go.
@@ -54,21 +56,43 @@ func NewService(localDB *Database, sumDB *SumDBClient, height int) *Service {
 		},
 	}
 	return &Service{
-		localDB: localDB,
-		sumDB:   sumDB,
-		rf:      rf,
-		height:  height,
+		localDB:  localDB,
+		sumDB:    sumDB,
+		rf:       rf,
+		height:   height,
+		progress: progressTracker{now: time.Now},
 	}
 }
 
+// Progress returns how far through the current or last operation this Service
+// is. It is safe to call this concurrently with any other method.
+func (s *Service) Progress() Progress {
+	return s.progress.get()
+}
+
+// LatestCheckpoint gets the freshest Checkpoint from the SumDB, which is only
+// returned if it is signed by one of the configured verifier keys. The key which
+// signed it is recorded in the Checkpoint.
+func (s *Service) LatestCheckpoint() (*Checkpoint, error) {
+	return s.sumDB.LatestCheckpoint()
+}
+
+// VerifiedCheckpoints returns every Checkpoint that the local database has been
+// verified against, along with the key which signed each of them.
+func (s *Service) VerifiedCheckpoints() ([]VerifiedCheckpoint, error) {
+	return s.localDB.VerifiedCheckpoints()
+}
+
 // CloneLeafTiles copies the leaf data from the SumDB into the local database.
-// It only copies whole tiles, which means that some stragglers may not be
-// copied locally.
-func (s *Service) CloneLeafTiles(ctx context.Context, checkpoint *tlog.Tree) error {
+// It only copies whole tiles; any stragglers are stored by CheckRootHash once
+// they have been verified. A partial tile of stragglers from a previous run is
+// fetched again in full. Tiles are fetched by a pool of the given number of workers,
+// each retrying with its own backoff, but are always written in order so that
+// the local leaves table never contains gaps.
+func (s *Service) CloneLeafTiles(ctx context.Context, checkpoint *tlog.Tree, workers int) error {
 	head, err := s.localDB.Head()
 	if err != nil {
-		glog.Infof("failed to find head of database, assuming empty and starting from scratch: %v", err)
-		head = -1
+		return fmt.Errorf("failed to find head of database: %v", err)
 	}
 	if checkpoint.N < head {
 		return fmt.Errorf("illegal state; more leaves locally (%d) than in SumDB (%d)", head, checkpoint.N)
@@ -76,146 +100,273 @@ func (s *Service) CloneLeafTiles(ctx context.Context, checkpoint *tlog.Tree) err
 	localLeaves := head + 1
 
 	tileWidth := int64(1 << s.height)
-	remainingLeaves := checkpoint.N - localLeaves
-	remainingChunks := int(remainingLeaves / tileWidth)
 	startOffset := int(localLeaves / tileWidth)
+	remainingChunks := int(checkpoint.N/tileWidth) - startOffset
 
-	if remainingChunks > 0 {
-		leafChan := make(chan tileLeaves)
-		errChan := make(chan error)
-		go func() {
-			for i := 0; i < remainingChunks; i++ {
-				var c tileLeaves
+	if remainingChunks <= 0 {
+		s.progress.start("clone leaves", 0)
+		s.progress.update(0, startOffset, 0)
+		return nil
+	}
+	s.progress.start("clone leaves", int64(remainingChunks)*tileWidth)
+	// Report where the clone resumes from until the first tile is written.
+	s.progress.update(0, startOffset, 0)
+	if workers < 1 {
+		workers = 1
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	jobs := make(chan leafTileJob)
+	// pending holds the result channels for in-flight fetches in offset order.
+	// Its capacity bounds how far ahead of the writer the workers can get.
+	pending := make(chan chan tileLeaves, workers)
+
+	g.Go(func() error {
+		defer close(jobs)
+		defer close(pending)
+		for i := 0; i < remainingChunks; i++ {
+			j := leafTileJob{offset: startOffset + i, result: make(chan tileLeaves, 1)}
+			select {
+			case pending <- j.result:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+			select {
+			case jobs <- j:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+		}
+		return nil
+	})
+
+	for w := 0; w < workers; w++ {
+		g.Go(func() error {
+			bo := backoff.WithContext(backoff.NewExponentialBackOff(), gctx)
+			for j := range jobs {
+				var leaves [][]byte
 				operation := func() error {
-					offset := startOffset + i
-					leaves, err := s.sumDB.FullLeavesAtOffset(offset)
-					if err != nil {
-						return err
-					}
-					c = tileLeaves{int64(offset) * tileWidth, leaves}
-					return nil
+					var err error
+					leaves, err = s.sumDB.FullLeavesAtOffset(j.offset)
+					return err
 				}
-				err := backoff.Retry(operation, backoff.NewExponentialBackOff())
-				if err != nil {
-					errChan <- err
-				} else {
-					leafChan <- c
+				if err := backoff.Retry(operation, bo); err != nil {
+					return fmt.Errorf("failed to fetch leaf tile at offset %d: %w", j.offset, err)
 				}
+				j.result <- tileLeaves{int64(j.offset) * tileWidth, leaves}
 			}
-		}()
+			return nil
+		})
+	}
 
-		for i := 0; i < remainingChunks; i++ {
+	g.Go(func() error {
+		for r := range pending {
 			select {
-			case err := <-errChan:
-				return err
-			case chunk := <-leafChan:
-				start, leaves := chunk.start, chunk.data
-				err = s.localDB.WriteLeaves(ctx, start, leaves)
-				if err != nil {
+			case chunk := <-r:
+				if err := s.localDB.WriteLeaves(gctx, chunk.start, chunk.data); err != nil {
 					return fmt.Errorf("WriteLeaves: %w", err)
 				}
+				s.progress.update(0, int(chunk.start/tileWidth), int64(len(chunk.data)))
+			case <-gctx.Done():
+				return gctx.Err()
 			}
 		}
-	}
-	return nil
+		return nil
+	})
+
+	return g.Wait()
 }
 
-// HashTiles performs a full recalculation of all the tiles using the data from
-// the leaves table. Any hashes that no longer match what was previously stored
-// will cause an error. Any new hashes will be filled in.
-// This could be replaced by something more incremental if the performance is
-// unnacceptable. While the SumDB is still reasonably small, this is fine as is.
+// HashTiles calculates the tiles for any leaves in the leaves table which have
+// not yet been hashed. Any new hashes which do not match what was previously
+// stored will cause an IntegrityError. This is a single streaming pass over the
+// new level 0 tiles, which resumes from the frontier of the tiles already
+// stored, so memory use is bounded by one tile of leaves plus one partial tile
+// per level; see tileHasher. Tiles which were stored by earlier runs are not
+// recalculated; use VerifyTiles or VerifyLocal to check them.
 func (s *Service) HashTiles(ctx context.Context, checkpoint *tlog.Tree) error {
-	tileWidth := 1 << s.height
-	tileCount := int(checkpoint.N / int64(tileWidth))
-
-	g := new(errgroup.Group)
-	roots := make(chan *compact.Range, tileWidth)
-
-	leafTileCount := tileCount
-	leafRoots := roots
-	g.Go(func() error { return s.hashLeafLevel(leafTileCount, leafRoots) })
-
-	for i := 1; i <= s.getLevelsForLeafCount(checkpoint.N); i++ {
-		tileCount /= tileWidth
-
-		thisLevel := i
-		thisTileCount := tileCount
-		in := roots
-
-		outRoots := make(chan *compact.Range, tileWidth)
-		g.Go(func() error { return s.hashUpperLevel(thisLevel, thisTileCount, in, outRoots) })
-
-		roots = outRoots
+	tileCount := int(checkpoint.N / int64(1<<s.height))
+	h := newTileHasher(s.height, s.localDB, s.tileRoot)
+	start, err := h.resume()
+	if err != nil {
+		return fmt.Errorf("failed to resume hashing: %w", err)
+	}
+	if start > tileCount {
+		start = tileCount
 	}
-	if err := g.Wait(); err != nil {
-		return fmt.Errorf("failed to hash: %v", err)
+	s.progress.start("hash tiles", int64(tileCount-start))
+
+	for offset := start; offset < tileCount; offset++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hashes, err := s.hashLeafTile(offset)
+		if err != nil {
+			return fmt.Errorf("failed to hash: %w", err)
+		}
+		if err := h.add(0, hashes); err != nil {
+			return fmt.Errorf("failed to hash: %w", err)
+		}
+		s.progress.update(0, offset, 1)
 	}
 	return nil
 }
 
 // CheckRootHash calculates the root hash from the locally generated tiles, and then
 // appends any stragglers from the SumDB, returning an error if this calculation
-// fails or the result does not match that in the checkpoint provided.
+// fails, or an IntegrityError if the result does not match that in the checkpoint
+// provided. If the root hash matches then the stragglers are stored in the local
+// database.
 func (s *Service) CheckRootHash(ctx context.Context, checkpoint *tlog.Tree) error {
-	logRange := s.rf.NewEmptyRange(0)
+	logRange, err := s.tileRange(checkpoint)
+	if err != nil {
+		return err
+	}
 
-	for level := s.getLevelsForLeafCount(checkpoint.N); level >= 0; level-- {
-		// how many real leaves a tile at this level covers.
-		tileLeafCount := uint64(1) << ((level + 1) * s.height)
-		levelTileCount := int(uint64(checkpoint.N) / tileLeafCount)
-		firstTileOffset := int(logRange.End() / tileLeafCount)
+	stragglersStart := logRange.End()
+	stragglersCount := int(uint64(checkpoint.N) - stragglersStart)
+	stragglerTileOffset := int(checkpoint.N / (1 << s.height))
+	stragglers, err := s.sumDB.PartialLeavesAtOffset(stragglerTileOffset, stragglersCount)
+	if err != nil {
+		return fmt.Errorf("failed to get stragglers: %v", err)
+	}
+	if err := s.checkRootHash(logRange, stragglers, checkpoint); err != nil {
+		return err
+	}
+	if stragglersCount > 0 {
+		if err := s.localDB.WriteLeaves(ctx, int64(stragglersStart), stragglers); err != nil {
+			return fmt.Errorf("failed to write stragglers: %v", err)
+		}
+	}
+	return nil
+}
 
-		for offset := firstTileOffset; offset < levelTileCount; offset++ {
-			tHashes, err := s.localDB.Tile(s.height, level, offset)
+// VerifyLocal checks the integrity of the local database against a checkpoint
+// that it was previously cloned to, without needing access to the SumDB. Every
+// tile is recalculated from the leaves or the tiles beneath it, and the root
+// hash is derived from the tiles and the stored stragglers. Level 0 tiles whose
+// leaves have been pruned cannot be recalculated, so are only checked by the
+// tiles above them. Rather than failing at the first problem, all
+// inconsistencies found are returned so that the extent of any corruption can
+// be assessed. An error is returned only if the checks could not be performed.
+func (s *Service) VerifyLocal(ctx context.Context, checkpoint *tlog.Tree) ([]Corruption, error) {
+	var corruptions []Corruption
+	tileWidth := 1 << s.height
+
+	var totalTiles int64
+	for level := 0; level <= s.getLevelsForLeafCount(checkpoint.N); level++ {
+		totalTiles += checkpoint.N >> uint((level+1)*s.height)
+	}
+	s.progress.start("verify tiles", totalTiles)
+
+	for level := 0; level <= s.getLevelsForLeafCount(checkpoint.N); level++ {
+		// how many real leaves a tile at this level covers.
+		tileLeafCount := int64(1) << ((level + 1) * s.height)
+		levelTileCount := int(checkpoint.N / tileLeafCount)
+
+		for offset := 0; offset < levelTileCount; offset++ {
+			s.progress.update(level, offset, 1)
+			c := Corruption{
+				Level:  level,
+				Offset: offset,
+				Start:  int64(offset) * tileLeafCount,
+				End:    int64(offset+1) * tileLeafCount,
+			}
+			stored, err := s.localDB.Tile(s.height, level, offset)
 			if err != nil {
-				return fmt.Errorf("failed to get tile L=%d, O=%d: %v", level, offset, err)
+				if err != sql.ErrNoRows {
+					return nil, fmt.Errorf("failed to get tile L=%d, O=%d: %v", level, offset, err)
+				}
+				c.Reason = "tile is missing"
+				corruptions = append(corruptions, c)
+				continue
 			}
-			// Calculate this tile as a standalone subtree
-			tcr := s.rf.NewEmptyRange(0)
-			for _, t := range tHashes {
-				tcr.Append(t, nil)
+
+			var derived [][]byte
+			if level == 0 {
+				leaves, err := s.localDB.Leaves(c.Start, tileWidth)
+				if err != nil {
+					c.Reason = fmt.Sprintf("leaves could not be read: %v", err)
+					corruptions = append(corruptions, c)
+					continue
+				}
+				if pruned(leaves) {
+					// There is no local data to check this tile against.
+					continue
+				}
+				for _, l := range leaves {
+					h := tlog.RecordHash(l)
+					derived = append(derived, h[:])
+				}
+			} else {
+				for i := 0; i < tileWidth; i++ {
+					lowerOffset := offset*tileWidth + i
+					lower, err := s.localDB.Tile(s.height, level-1, lowerOffset)
+					if err != nil {
+						if err != sql.ErrNoRows {
+							return nil, fmt.Errorf("failed to get tile L=%d, O=%d: %v", level-1, lowerOffset, err)
+						}
+						// The missing tile will already have been reported at the lower level.
+						break
+					}
+					root, err := s.tileRoot(lower)
+					if err != nil {
+						return nil, err
+					}
+					derived = append(derived, root)
+				}
+				if len(derived) != tileWidth {
+					c.Reason = "tiles beneath are missing"
+					corruptions = append(corruptions, c)
+					continue
+				}
 			}
-			// Now use the range as what it really is; a commitment to a larger number of leaves
-			treeRange, err := s.rf.NewRange(uint64(offset)*tileLeafCount, uint64(offset+1)*tileLeafCount, tcr.Hashes())
-			if err != nil {
-				return fmt.Errorf("failed to create range for tile L=%d, O=%d: %v", level, offset, err)
+
+			for i := range derived {
+				if !bytes.Equal(derived[i], stored[i]) {
+					c.Reason = fmt.Sprintf("hash %d does not match the hash derived from the data beneath it", i)
+					corruptions = append(corruptions, c)
+					break
+				}
 			}
-			// Append this into the running log range.
-			logRange.AppendRange(treeRange, nil)
 		}
 	}
 
-	stragglersCount := int(uint64(checkpoint.N) - logRange.End())
-	stragglerTileOffset := int(checkpoint.N / (1 << s.height))
-	stragglers, err := s.sumDB.PartialLeavesAtOffset(stragglerTileOffset, stragglersCount)
-	if err != nil {
-		return fmt.Errorf("failed to get stragglers: %v", err)
-	}
-	for _, s := range stragglers {
-		sHash := tlog.RecordHash(s)
-		logRange.Append(sHash[:], nil)
+	if len(corruptions) > 0 {
+		// The root hash cannot be derived from corrupt tiles.
+		return corruptions, nil
 	}
 
-	if logRange.End() != uint64(checkpoint.N) {
-		return fmt.Errorf("calculation error, found %d leaves but expected %d", logRange.End(), checkpoint.N)
+	logRange, err := s.tileRange(checkpoint)
+	if err != nil {
+		return nil, err
 	}
-
-	root, err := logRange.GetRootHash(nil)
+	stragglersStart := int64(logRange.End())
+	stragglers, err := s.localDB.Leaves(stragglersStart, int(checkpoint.N-stragglersStart))
 	if err != nil {
-		return fmt.Errorf("failed to get root hash: %v", err)
+		return append(corruptions, Corruption{
+			Level:  0,
+			Offset: int(checkpoint.N / int64(tileWidth)),
+			Start:  stragglersStart,
+			End:    checkpoint.N,
+			Reason: fmt.Sprintf("stragglers could not be read: %v", err),
+		}), nil
 	}
-	var rootHash tlog.Hash
-	copy(rootHash[:], root)
-	if rootHash != checkpoint.Hash {
-		return fmt.Errorf("log root mismatch at tree size %d; calculated %x, SumDB says %x", checkpoint.N, root, checkpoint.Hash[:])
+	if err := s.checkRootHash(logRange, stragglers, checkpoint); err != nil {
+		return append(corruptions, Corruption{
+			Level:  -1,
+			Start:  0,
+			End:    checkpoint.N,
+			Reason: err.Error(),
+		}), nil
 	}
-	return nil
+	return corruptions, nil
 }
 
 // VerifyTiles checks that every tile calculated locally matches the result returned
-// by SumDB. This shouldn't be necessary if CheckRootHash is working, but this may be
-// useful to determine where any corruption has happened in the tree.
+// by SumDB, returning an IntegrityError for the first that does not. This shouldn't
+// be necessary if CheckRootHash is working, but this may be useful to determine
+// where any corruption has happened in the tree.
 func (s *Service) VerifyTiles(ctx context.Context, checkpoint *tlog.Tree) error {
 	for level := 0; level <= s.getLevelsForLeafCount(checkpoint.N); level++ {
 		finishedLevel := false
@@ -238,7 +389,7 @@ func (s *Service) VerifyTiles(ctx context.Context, checkpoint *tlog.Tree) error
 				var lHash tlog.Hash
 				copy(lHash[:], localHashes[i])
 				if sumDBHashes[i] != lHash {
-					return fmt.Errorf("found mismatched hash at L=%d, O=%d, leaf=%d\n\tlocal : %x\n\tremote: %x", level, offset, i, sumDBHashes[i][:], localHashes[i])
+					return &IntegrityError{Err: fmt.Errorf("found mismatched hash at L=%d, O=%d, leaf=%d\n\tlocal : %x\n\tremote: %x", level, offset, i, sumDBHashes[i][:], localHashes[i])}
 				}
 			}
 			offset++
@@ -248,16 +399,30 @@ func (s *Service) VerifyTiles(ctx context.Context, checkpoint *tlog.Tree) error
 }
 
 // ProcessMetadata parses the leaf data and writes the semantic data into the DB.
+// Processing resumes from the first tile without metadata.
 func (s *Service) ProcessMetadata(ctx context.Context, checkpoint *tlog.Tree) error {
 	tileWidth := 1 << s.height
 	metadata := make([]Metadata, tileWidth)
-	// TODO: skip to head of metadata
-	for offset := 0; offset < int(checkpoint.N/int64(tileWidth)); offset++ {
+	tileCount := int(checkpoint.N / int64(tileWidth))
+	head, err := s.localDB.MetadataHead()
+	if err != nil {
+		return fmt.Errorf("failed to find head of metadata: %v", err)
+	}
+	startOffset := int((head + 1) / int64(tileWidth))
+	if startOffset > tileCount {
+		startOffset = tileCount
+	}
+	s.progress.start("process metadata", int64(tileCount-startOffset))
+	for offset := startOffset; offset < tileCount; offset++ {
 		leafOffset := int64(offset) * int64(tileWidth)
 		hashes, err := s.localDB.Leaves(leafOffset, tileWidth)
 		if err != nil {
 			return err
 		}
+		if pruned(hashes) {
+			// Leaves are only pruned after their metadata has been processed.
+			continue
+		}
 		for i, h := range hashes {
 			leafID := leafOffset + int64(i)
 
@@ -278,27 +443,7 @@ func (s *Service) ProcessMetadata(ctx context.Context, checkpoint *tlog.Tree) er
 		if err := s.localDB.SetLeafMetadata(ctx, leafOffset, metadata); err != nil {
 			return err
 		}
-	}
-	return nil
-}
-
-func (s *Service) hashLeafLevel(tileCount int, roots chan<- *compact.Range) error {
-	for offset := 0; offset < tileCount; offset++ {
-		hashes, err := s.localDB.Tile(s.height, 0, offset)
-		if err == sql.ErrNoRows {
-			hashes, err = s.hashLeafTile(offset)
-		}
-		if err != nil {
-			return err
-		}
-		cr := s.rf.NewEmptyRange(uint64(offset) * 1 << s.height)
-		for _, h := range hashes {
-			cr.Append(h, nil)
-		}
-		if got, want := len(cr.Hashes()), 1; got != want {
-			return fmt.Errorf("expected single root hash but got %d", got)
-		}
-		roots <- cr
+		s.progress.update(0, offset, 1)
 	}
 	return nil
 }
@@ -320,48 +465,75 @@ func (s *Service) hashLeafTile(offset int) ([][]byte, error) {
 	return res, s.localDB.SetTile(s.height, 0, offset, leafHashes)
 }
 
-func (s *Service) hashUpperLevel(level, tileCount int, in <-chan *compact.Range, out chan<- *compact.Range) error {
-	tileWidth := 1 << s.height
+// tileRange calculates the compact range covering all of the complete tiles
+// within the checkpoint, using the tiles stored in the local database.
+func (s *Service) tileRange(checkpoint *tlog.Tree) (*compact.Range, error) {
+	logRange := s.rf.NewEmptyRange(0)
 
-	inHashes := make([][]byte, tileWidth)
-	tileHashBlob := make([]byte, tileWidth*HashLenBytes)
-	for offset := 0; offset < tileCount; offset++ {
-		dbTileHashes, err := s.localDB.Tile(s.height, level, offset)
-		found := true
-		if err == sql.ErrNoRows {
-			found = false
-			err = nil
-		}
-		if err != nil {
-			return err
-		}
-		for i := 0; i < tileWidth; i++ {
-			cr := <-in
-			inHashes[i] = cr.Hashes()[0]
-			copy(tileHashBlob[i*HashLenBytes:], inHashes[i])
+	for level := s.getLevelsForLeafCount(checkpoint.N); level >= 0; level-- {
+		// how many real leaves a tile at this level covers.
+		tileLeafCount := uint64(1) << ((level + 1) * s.height)
+		levelTileCount := int(uint64(checkpoint.N) / tileLeafCount)
+		firstTileOffset := int(logRange.End() / tileLeafCount)
 
-			if found && !bytes.Equal(dbTileHashes[i], inHashes[i]) {
-				return fmt.Errorf("got diffence in hash at L=%d, O=%d, leaf=%d", level, offset, i)
+		for offset := firstTileOffset; offset < levelTileCount; offset++ {
+			tHashes, err := s.localDB.Tile(s.height, level, offset)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get tile L=%d, O=%d: %v", level, offset, err)
 			}
-		}
-
-		if !found {
-			if err := s.localDB.SetTile(s.height, level, offset, tileHashBlob); err != nil {
-				return fmt.Errorf("failed to set tile at L=%d, O=%d: %v", level, offset, err)
+			// Calculate this tile as a standalone subtree
+			tcr := s.rf.NewEmptyRange(0)
+			for _, t := range tHashes {
+				tcr.Append(t, nil)
 			}
+			// Now use the range as what it really is; a commitment to a larger number of leaves
+			treeRange, err := s.rf.NewRange(uint64(offset)*tileLeafCount, uint64(offset+1)*tileLeafCount, tcr.Hashes())
+			if err != nil {
+				return nil, fmt.Errorf("failed to create range for tile L=%d, O=%d: %v", level, offset, err)
+			}
+			// Append this into the running log range.
+			logRange.AppendRange(treeRange, nil)
 		}
-		cr := s.rf.NewEmptyRange(uint64(offset * tileWidth))
-		for _, h := range inHashes {
-			cr.Append(h, nil)
-		}
-		if got, want := len(cr.Hashes()), 1; got != want {
-			return fmt.Errorf("expected single root hash but got %d", got)
-		}
-		out <- cr
+	}
+	return logRange, nil
+}
+
+// checkRootHash appends the stragglers to the range of complete tiles and
+// checks that the resulting root hash matches the checkpoint.
+func (s *Service) checkRootHash(logRange *compact.Range, stragglers [][]byte, checkpoint *tlog.Tree) error {
+	for _, s := range stragglers {
+		sHash := tlog.RecordHash(s)
+		logRange.Append(sHash[:], nil)
+	}
+
+	if logRange.End() != uint64(checkpoint.N) {
+		return fmt.Errorf("calculation error, found %d leaves but expected %d", logRange.End(), checkpoint.N)
+	}
+
+	root, err := logRange.GetRootHash(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get root hash: %v", err)
+	}
+	var rootHash tlog.Hash
+	copy(rootHash[:], root)
+	if rootHash != checkpoint.Hash {
+		return &IntegrityError{Err: fmt.Errorf("log root mismatch at tree size %d; calculated %x, SumDB says %x", checkpoint.N, root, checkpoint.Hash[:])}
 	}
 	return nil
 }
 
+// tileRoot calculates the root hash of the perfect subtree stored in a tile.
+func (s *Service) tileRoot(hashes [][]byte) ([]byte, error) {
+	cr := s.rf.NewEmptyRange(0)
+	for _, h := range hashes {
+		cr.Append(h, nil)
+	}
+	if got, want := len(cr.Hashes()), 1; got != want {
+		return nil, fmt.Errorf("expected single root hash but got %d", got)
+	}
+	return cr.Hashes()[0], nil
+}
+
 // getLevelsForLeafCount determines how many strata of tiles of the configured
 // height are needed to contain the largest perfect subtree that can be made of
 // the leaves.
@@ -380,3 +552,42 @@ type tileLeaves struct {
 	start int64    // The leaf index of the first leaf
 	data  [][]byte // The leaf data
 }
+
+// IntegrityError is returned when the SumDB, or the local copy of it, has been
+// found to contradict the Checkpoints that it has signed. Unlike other errors,
+// retrying the operation will not resolve it.
+type IntegrityError struct {
+	Err error
+}
+
+func (e *IntegrityError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *IntegrityError) Unwrap() error {
+	return e.Err
+}
+
+// Corruption describes a part of the local database which is inconsistent with
+// the data that it was derived from.
+type Corruption struct {
+	Level  int    // The level of the tile, or -1 for the root hash
+	Offset int    // The offset of the tile within its level
+	Start  int64  // The index of the first leaf covered
+	End    int64  // The index after the last leaf covered
+	Reason string // A description of the inconsistency
+}
+
+func (c Corruption) String() string {
+	if c.Level < 0 {
+		return fmt.Sprintf("root hash for leaves [%d, %d): %s", c.Start, c.End, c.Reason)
+	}
+	return fmt.Sprintf("tile L=%d, O=%d covering leaves [%d, %d): %s", c.Level, c.Offset, c.Start, c.End, c.Reason)
+}
+
+// leafTileJob is a request for a worker to fetch the leaf tile at offset.
+type leafTileJob struct {
+	offset int             // The offset of the tile at level 0
+	result chan tileLeaves // Receives the leaves once fetched
+}
@@ -0,0 +1,217 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// clone runs the same sequence of operations as the clone tool to copy the
+// first size leaves of the log into the database of s.
+func clone(t *testing.T, s *Service, m *memoryLog, size int64) *Checkpoint {
+	t.Helper()
+	ctx := context.Background()
+	cp := m.setLatest(t, size)
+	if err := s.CloneLeafTiles(ctx, &cp.Tree, 2); err != nil {
+		t.Fatalf("CloneLeafTiles: %v", err)
+	}
+	if err := s.HashTiles(ctx, &cp.Tree); err != nil {
+		t.Fatalf("HashTiles: %v", err)
+	}
+	if err := s.CheckRootHash(ctx, &cp.Tree); err != nil {
+		t.Fatalf("CheckRootHash: %v", err)
+	}
+	if err := s.localDB.SetGoldenCheckpoint(cp); err != nil {
+		t.Fatalf("SetGoldenCheckpoint: %v", err)
+	}
+	if err := s.ProcessMetadata(ctx, &cp.Tree); err != nil {
+		t.Fatalf("ProcessMetadata: %v", err)
+	}
+	return cp
+}
+
+func TestVerifyLocal(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		corrupt string // Statement run against the database after cloning
+		want    Corruption
+	}{
+		{
+			name: "intact",
+		},
+		{
+			name:    "leaf",
+			corrupt: "UPDATE leaves SET data=X'00' WHERE id=5",
+			want:    Corruption{Level: 0, Offset: 1, Start: 4, End: 8},
+		},
+		{
+			name:    "tile",
+			corrupt: `UPDATE tiles SET hashes=zeroblob(128) WHERE level=1 AND "offset"=0`,
+			want:    Corruption{Level: 1, Offset: 0, Start: 0, End: 16},
+		},
+		{
+			name:    "straggler",
+			corrupt: "UPDATE leaves SET data=X'00' WHERE id=17",
+			want:    Corruption{Level: -1, Start: 0, End: 19},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			d, cleanup := newTestDatabase(t)
+			defer cleanup()
+			m := newMemoryLog(t, moduleLeaves(19))
+			s := NewService(d, m.client, 2)
+			cp := clone(t, s, m, 19)
+			if len(test.corrupt) > 0 {
+				if _, err := d.db.Exec(test.corrupt); err != nil {
+					t.Fatalf("failed to corrupt database: %v", err)
+				}
+			}
+
+			corruptions, err := s.VerifyLocal(context.Background(), &cp.Tree)
+			if err != nil {
+				t.Fatalf("VerifyLocal: %v", err)
+			}
+			if len(test.corrupt) == 0 {
+				if len(corruptions) > 0 {
+					t.Fatalf("got corruptions %v, want none", corruptions)
+				}
+				return
+			}
+			if got, want := len(corruptions), 1; got != want {
+				t.Fatalf("got %d corruptions (%v), want %d", got, corruptions, want)
+			}
+			got := corruptions[0]
+			got.Reason = ""
+			if got != test.want {
+				t.Errorf("got corruption %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCloneTwice(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, d *Database) {
+		if err := d.Init(); err != nil {
+			t.Fatalf("Init: %v", err)
+		}
+		m := newMemoryLog(t, moduleLeaves(19))
+		s := NewService(d, m.client, 2)
+		// Cloning the same checkpoint again must be a no-op, and cloning a
+		// larger one must resume from where the last clone finished.
+		for _, size := range []int64{10, 10, 19} {
+			clone(t, s, m, size)
+		}
+
+		head, err := d.MetadataHead()
+		if err != nil {
+			t.Fatalf("MetadataHead: %v", err)
+		}
+		if got, want := head, int64(15); got != want {
+			t.Errorf("got metadata head %d, want %d", got, want)
+		}
+		for i, l := range moduleLeaves(16) {
+			var module, version string
+			if _, err := fmt.Sscan(l, &module, &version); err != nil {
+				t.Fatalf("failed to parse leaf %d: %v", i, err)
+			}
+			md, err := d.LookupMetadata(module, version)
+			if err != nil {
+				t.Fatalf("LookupMetadata: %v", err)
+			}
+			if got, want := len(md), 1; got != want {
+				t.Errorf("%s@%s: got %d metadata, want %d", module, version, got, want)
+			}
+		}
+	})
+}
+
+func TestCheckRootHashMismatch(t *testing.T) {
+	d, cleanup := newTestDatabase(t)
+	defer cleanup()
+	m := newMemoryLog(t, moduleLeaves(19))
+	s := NewService(d, m.client, 2)
+	ctx := context.Background()
+
+	cp := m.setLatest(t, 19)
+	cp.Hash[0] ^= 1
+	if err := s.CloneLeafTiles(ctx, &cp.Tree, 1); err != nil {
+		t.Fatalf("CloneLeafTiles: %v", err)
+	}
+	if err := s.HashTiles(ctx, &cp.Tree); err != nil {
+		t.Fatalf("HashTiles: %v", err)
+	}
+	var ie *IntegrityError
+	if err := s.CheckRootHash(ctx, &cp.Tree); !errors.As(err, &ie) {
+		t.Errorf("got error %v, want IntegrityError", err)
+	}
+}
+
+func TestCloneLeafTilesProgress(t *testing.T) {
+	d, cleanup := newTestDatabase(t)
+	defer cleanup()
+	m := newMemoryLog(t, moduleLeaves(19))
+	s := NewService(d, m.client, 2)
+	ctx := context.Background()
+
+	if head, err := d.Head(); err != nil || head != -1 {
+		t.Fatalf("Head of empty database: got (%d, %v), want (-1, nil)", head, err)
+	}
+	for _, test := range []struct {
+		size        int64
+		offset      int
+		done, total int64
+	}{
+		{size: 9, offset: 1, done: 8, total: 8},
+		// Nothing to do, but the offset that the clone would resume from is reported.
+		{size: 9, offset: 2, done: 0, total: 0},
+		{size: 19, offset: 3, done: 8, total: 8},
+	} {
+		cp := m.checkpoint(t, test.size)
+		if err := s.CloneLeafTiles(ctx, &cp.Tree, 1); err != nil {
+			t.Fatalf("CloneLeafTiles(%d): %v", test.size, err)
+		}
+		p := s.Progress()
+		if p.Stage != "clone leaves" || p.Offset != test.offset || p.Done != test.done || p.Total != test.total {
+			t.Errorf("CloneLeafTiles(%d): got progress %+v, want offset %d and %d/%d done", test.size, p, test.offset, test.done, test.total)
+		}
+	}
+}
+
+func TestHashTilesResume(t *testing.T) {
+	d, cleanup := newTestDatabase(t)
+	defer cleanup()
+	m := newMemoryLog(t, moduleLeaves(19))
+	s := NewService(d, m.client, 2)
+	ctx := context.Background()
+	clone(t, s, m, 10)
+
+	cp := m.setLatest(t, 19)
+	if err := s.CloneLeafTiles(ctx, &cp.Tree, 1); err != nil {
+		t.Fatalf("CloneLeafTiles: %v", err)
+	}
+	if err := s.HashTiles(ctx, &cp.Tree); err != nil {
+		t.Fatalf("HashTiles: %v", err)
+	}
+	// Only the level 0 tiles which were not hashed by the first clone are read.
+	if p := s.Progress(); p.Stage != "hash tiles" || p.Done != 2 || p.Total != 2 {
+		t.Errorf("got progress %+v, want 2/2 tiles hashed", p)
+	}
+	if err := s.CheckRootHash(ctx, &cp.Tree); err != nil {
+		t.Errorf("CheckRootHash: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"fmt"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// SplitView is evidence that the SumDB has presented different views of the
+// log to different clients. Both Checkpoints are validly signed, but they
+// cannot both be Checkpoints of the same append-only log.
+type SplitView struct {
+	A, B   *Checkpoint
+	Reason string
+}
+
+func (v SplitView) String() string {
+	return fmt.Sprintf("tree size %d with hash %s and tree size %d with hash %s: %s", v.A.N, v.A.Hash, v.B.N, v.B.Hash, v.Reason)
+}
+
+// CompareCheckpoints checks that Checkpoints a and b, which were fetched using
+// clients clientA and clientB respectively, are consistent with each other. The
+// consistency proof is calculated from the tiles served for the larger of the
+// two Checkpoints. A SplitView is returned if the Checkpoints are inconsistent,
+// and an error is returned if consistency could not be determined.
+func CompareCheckpoints(a, b *Checkpoint, clientA, clientB *SumDBClient) (*SplitView, error) {
+	older, newer, client := a, b, clientB
+	if a.N > b.N {
+		older, newer, client = b, a, clientA
+	}
+	if older.N == newer.N {
+		if older.Hash != newer.Hash {
+			return &SplitView{A: a, B: b, Reason: "different hashes for the same tree size"}, nil
+		}
+		return nil, nil
+	}
+	if older.N == 0 {
+		return nil, nil
+	}
+	proof, err := tlog.ProveTree(newer.N, older.N, tlog.TileHashReader(newer.Tree, &remoteTileReader{c: client}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate consistency proof: %v", err)
+	}
+	if err := tlog.CheckTree(proof, newer.N, newer.Hash, older.N, older.Hash); err != nil {
+		return &SplitView{A: a, B: b, Reason: err.Error()}, nil
+	}
+	return nil, nil
+}
+
+// remoteTileReader implements tlog.TileReader by fetching tiles from the SumDB.
+type remoteTileReader struct {
+	c *SumDBClient
+}
+
+func (r *remoteTileReader) Height() int {
+	return r.c.height
+}
+
+func (r *remoteTileReader) ReadTiles(tiles []tlog.Tile) ([][]byte, error) {
+	data := make([][]byte, len(tiles))
+	for i, t := range tiles {
+		d, err := r.c.fetcher.GetData("/" + t.Path())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get tile %s: %v", t.Path(), err)
+		}
+		data[i] = d
+	}
+	return data, nil
+}
+
+func (r *remoteTileReader) SaveTiles(tiles []tlog.Tile, data [][]byte) {}
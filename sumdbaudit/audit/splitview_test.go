@@ -0,0 +1,58 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCompareCheckpoints(t *testing.T) {
+	var leaves, forked []string
+	for i := 0; i < 11; i++ {
+		leaves = append(leaves, fmt.Sprintf("leaf %d\n", i))
+		forked = append(forked, fmt.Sprintf("leaf %d\n", i))
+	}
+	forked[3] = "forked leaf\n"
+	good, bad := newMemoryLog(t, leaves), newMemoryLog(t, forked)
+
+	for _, test := range []struct {
+		name      string
+		a, b      *memoryLog
+		sizeA     int64
+		sizeB     int64
+		wantSplit bool
+	}{
+		{name: "same checkpoint", a: good, b: good, sizeA: 11, sizeB: 11},
+		{name: "a behind", a: good, b: good, sizeA: 5, sizeB: 11},
+		{name: "b behind", a: good, b: good, sizeA: 11, sizeB: 1},
+		{name: "empty", a: good, b: good, sizeA: 0, sizeB: 11},
+		{name: "fork before divergence", a: good, b: bad, sizeA: 3, sizeB: 11},
+		{name: "fork same size", a: good, b: bad, sizeA: 7, sizeB: 7, wantSplit: true},
+		{name: "fork a behind", a: good, b: bad, sizeA: 5, sizeB: 11, wantSplit: true},
+		{name: "fork b behind", a: good, b: bad, sizeA: 11, sizeB: 9, wantSplit: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			a, b := test.a.checkpoint(t, test.sizeA), test.b.checkpoint(t, test.sizeB)
+			split, err := CompareCheckpoints(a, b, test.a.client, test.b.client)
+			if err != nil {
+				t.Fatalf("CompareCheckpoints: %v", err)
+			}
+			if got, want := split != nil, test.wantSplit; got != want {
+				t.Errorf("got split view %v, want %t", split, want)
+			}
+		})
+	}
+}
@@ -15,15 +15,19 @@
 package audit
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/mod/sumdb/note"
 	"golang.org/x/mod/sumdb/tlog"
+	"golang.org/x/time/rate"
 )
 
 // HashLenBytes is the number of bytes in the SumDB hashes.
@@ -43,48 +47,173 @@ type Fetcher interface {
 // SumDBClient provides access to information from the Sum DB.
 type SumDBClient struct {
 	height  int
-	vkey    string
+	vkeys   []string // Checkpoints signed by any of these keys are accepted
 	fetcher Fetcher
 }
 
+// DefaultHTTPTimeout is how long each request to the SumDB is given to
+// complete, unless configured otherwise.
+const DefaultHTTPTimeout = time.Minute
+
+// HTTPOptions configures how data is fetched from the SumDB over HTTP(S).
+// The zero value fetches data as fast as possible, using any proxy configured
+// by the environment.
+type HTTPOptions struct {
+	// BaseURL is the URL of the SumDB API, e.g. to access it through a proxy
+	// such as https://proxy.golang.org/sumdb/sum.golang.org. If empty, the
+	// SumDB is accessed directly at the host named by the verifier key.
+	BaseURL string
+	// ProxyURL is the proxy to send all requests through, which can be an
+	// http, https or socks5 URL. If nil, the proxy environment variables are
+	// used as described by http.ProxyFromEnvironment.
+	ProxyURL *url.URL
+	// RequestsPerSecond is the maximum rate of requests, or 0 for no limit.
+	RequestsPerSecond float64
+	// BytesPerSecond is the maximum rate of download, or 0 for no limit.
+	BytesPerSecond int
+	// Timeout limits the time taken by each request, including reading the
+	// response at the limited rate. If zero, DefaultHTTPTimeout is used.
+	Timeout time.Duration
+}
+
 // NewSumDB creates a new client that fetches tiles of the given height.
 func NewSumDB(height int, vkey string) *SumDBClient {
-	name := vkey
-	if i := strings.Index(name, "+"); i >= 0 {
-		name = name[:i]
+	return NewSumDBWithOptions(height, vkey, HTTPOptions{})
+}
+
+// NewSumDBWithOptions creates a new client that fetches tiles of the given
+// height, with the HTTP behaviour configured by opts.
+func NewSumDBWithOptions(height int, vkey string, opts HTTPOptions) *SumDBClient {
+	return &SumDBClient{
+		height:  height,
+		vkeys:   []string{vkey},
+		fetcher: NewHTTPFetcher(baseURL(vkey, opts), opts),
 	}
-	target := "https://" + name
+}
 
+// NewSumDBWithKeys creates a new client like NewSumDBWithOptions, which accepts
+// Checkpoints signed by any of the given verifier keys. This allows the SumDB to
+// rotate its key. All keys must have the same name, which is the SumDB host.
+func NewSumDBWithKeys(height int, vkeys []string, opts HTTPOptions) (*SumDBClient, error) {
+	if len(vkeys) == 0 {
+		return nil, fmt.Errorf("no verifier keys given")
+	}
+	for _, vkey := range vkeys {
+		v, err := note.NewVerifier(vkey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid verifier key %q: %v", vkey, err)
+		}
+		if v.Name() != keyName(vkeys[0]) {
+			return nil, fmt.Errorf("verifier key %q does not have the same name as %q", vkey, vkeys[0])
+		}
+	}
 	return &SumDBClient{
 		height:  height,
-		vkey:    vkey,
-		fetcher: &HTTPFetcher{baseURL: target},
+		vkeys:   vkeys,
+		fetcher: NewHTTPFetcher(baseURL(vkeys[0], opts), opts),
+	}, nil
+}
+
+// SplitVerifierKeys splits a comma separated list of verifier keys, as accepted
+// by the -k flag of the command line tools.
+func SplitVerifierKeys(keys string) []string {
+	var res []string
+	for _, k := range strings.Split(keys, ",") {
+		if k = strings.TrimSpace(k); len(k) > 0 {
+			res = append(res, k)
+		}
 	}
+	return res
+}
+
+// keyName returns the name of the signer of a verifier key.
+func keyName(vkey string) string {
+	if i := strings.Index(vkey, "+"); i >= 0 {
+		return vkey[:i]
+	}
+	return vkey
+}
+
+// baseURL returns the URL of the SumDB API, which is the host named by the key
+// unless overridden in opts.
+func baseURL(vkey string, opts HTTPOptions) string {
+	if len(opts.BaseURL) > 0 {
+		return strings.TrimSuffix(opts.BaseURL, "/")
+	}
+	return "https://" + keyName(vkey)
+}
+
+// VerifierKeys returns the keys which Checkpoints are accepted as signed by.
+func (c *SumDBClient) VerifierKeys() []string {
+	return c.vkeys
+}
+
+// Checkpoint is a verified tree head from the SumDB, along with the signed note
+// that it was parsed from.
+type Checkpoint struct {
+	tlog.Tree
+	Raw         []byte // The signed note that the Tree was parsed from
+	VerifierKey string // The key which the note was verified with
 }
 
 // LatestCheckpoint gets the freshest Checkpoint.
-func (c *SumDBClient) LatestCheckpoint() (*tlog.Tree, error) {
+func (c *SumDBClient) LatestCheckpoint() (*Checkpoint, error) {
 	checkpoint, err := c.fetcher.GetData("/latest")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get /latest Checkpoint; %w", err)
 	}
+	return c.ParseCheckpointNote(checkpoint)
+}
 
-	verifier, err := note.NewVerifier(c.vkey)
-	if err != nil {
-		log.Fatal(err)
+// ParseCheckpointNote parses a signed note, returning the Checkpoint within it
+// only if the note is signed by one of the keys this client was configured
+// with. Notes which are unsigned, or only signed by unknown keys, are rejected.
+func (c *SumDBClient) ParseCheckpointNote(checkpoint []byte) (*Checkpoint, error) {
+	return parseCheckpointNote(checkpoint, c.vkeys)
+}
+
+// ParseStoredCheckpoint parses a signed note which was previously verified and
+// stored along with the key that verified it. The note is checked against that
+// key, rather than the keys this client was configured with, so that a key can
+// be retired after a rotation without invalidating the checkpoints it signed.
+// If no key was stored, this is the same as ParseCheckpointNote.
+func (c *SumDBClient) ParseStoredCheckpoint(checkpoint []byte, vkey string) (*Checkpoint, error) {
+	if len(vkey) == 0 {
+		return c.ParseCheckpointNote(checkpoint)
+	}
+	if got, want := keyName(vkey), keyName(c.vkeys[0]); got != want {
+		return nil, fmt.Errorf("checkpoint was verified by a key for %s, not %s", got, want)
+	}
+	return parseCheckpointNote(checkpoint, []string{vkey})
+}
+
+func parseCheckpointNote(checkpoint []byte, vkeys []string) (*Checkpoint, error) {
+	verifiers := make([]note.Verifier, len(vkeys))
+	for i, vkey := range vkeys {
+		v, err := note.NewVerifier(vkey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create verifier: %w", err)
+		}
+		verifiers[i] = v
 	}
-	verifiers := note.VerifierList(verifier)
 
-	note, err := note.Open(checkpoint, verifiers)
+	n, err := note.Open(checkpoint, note.VerifierList(verifiers...))
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("failed to verify note: %w", err)
 	}
-	tree, err := tlog.ParseTree([]byte(note.Text))
+	tree, err := tlog.ParseTree([]byte(n.Text))
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("failed to parse tree: %w", err)
 	}
 
-	return &tree, nil
+	// Open only returns signatures that were verified by a known key.
+	sig := n.Sigs[0]
+	for i, v := range verifiers {
+		if v.Name() == sig.Name && v.KeyHash() == sig.Hash {
+			return &Checkpoint{Tree: tree, Raw: checkpoint, VerifierKey: vkeys[i]}, nil
+		}
+	}
+	return nil, fmt.Errorf("no verifier key found for signature by %s+%08x", sig.Name, sig.Hash)
 }
 
 // FullLeavesAtOffset gets the Nth chunk of 2**height leaves.
@@ -150,25 +279,122 @@ func (c *SumDBClient) TileHashes(level, offset int) ([]tlog.Hash, error) {
 	return hashes, nil
 }
 
-// HTTPFetcher gets the data over HTTP(S).
+// HTTPFetcher gets the data over HTTP(S). Responses are transparently
+// decompressed if the server supports gzip. Conditional requests are used
+// when fetching mutable paths (i.e. anything other than tiles) which have been
+// fetched before, so that unchanged data is not downloaded again.
 type HTTPFetcher struct {
-	baseURL string
+	baseURL  string
+	client   *http.Client
+	requests *rate.Limiter // nil if requests are not limited
+	bytes    *rate.Limiter // nil if bandwidth is not limited
+
+	mu    sync.Mutex
+	cache map[string]cachedResponse // Keyed by path
+}
+
+// cachedResponse is the data for a path along with the validators needed to
+// make a conditional request for it.
+type cachedResponse struct {
+	etag, lastModified string
+	data               []byte
+}
+
+// NewHTTPFetcher creates a fetcher which gets data from paths under baseURL.
+func NewHTTPFetcher(baseURL string, opts HTTPOptions) *HTTPFetcher {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.ProxyURL != nil {
+		transport.Proxy = http.ProxyURL(opts.ProxyURL)
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHTTPTimeout
+	}
+	f := &HTTPFetcher{
+		baseURL: baseURL,
+		client:  &http.Client{Transport: transport, Timeout: timeout},
+		cache:   make(map[string]cachedResponse),
+	}
+	if opts.RequestsPerSecond > 0 {
+		f.requests = rate.NewLimiter(rate.Limit(opts.RequestsPerSecond), 1)
+	}
+	if opts.BytesPerSecond > 0 {
+		f.bytes = rate.NewLimiter(rate.Limit(opts.BytesPerSecond), opts.BytesPerSecond)
+	}
+	return f
 }
 
 // GetData gets the data.
 func (f *HTTPFetcher) GetData(path string) ([]byte, error) {
+	ctx := context.Background()
+	if f.requests != nil {
+		if err := f.requests.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
 	target := f.baseURL + path
-	resp, err := http.Get(target)
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	cacheable := !strings.HasPrefix(path, "/tile/")
+	f.mu.Lock()
+	cached, found := f.cache[path]
+	f.mu.Unlock()
+	if found {
+		if len(cached.etag) > 0 {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if len(cached.lastModified) > 0 {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	resp, err := f.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && found {
+		return cached.data, nil
+	}
 	if resp.StatusCode != 200 {
 		return nil, fmt.Errorf("GET %v: %v", target, resp.Status)
 	}
-	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	var body io.Reader = resp.Body
+	if f.bytes != nil {
+		body = &rateLimitedReader{r: body, l: f.bytes}
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(body, 1<<20))
 	if err != nil {
 		return nil, err
 	}
+	if cacheable {
+		etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+		if len(etag) > 0 || len(lastModified) > 0 {
+			f.mu.Lock()
+			f.cache[path] = cachedResponse{etag: etag, lastModified: lastModified, data: data}
+			f.mu.Unlock()
+		}
+	}
 	return data, nil
 }
+
+// rateLimitedReader is an io.Reader which limits the rate that data is read.
+type rateLimitedReader struct {
+	r io.Reader
+	l *rate.Limiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > r.l.Burst() {
+		p = p[:r.l.Burst()]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.l.WaitN(context.Background(), n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
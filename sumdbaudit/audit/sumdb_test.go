@@ -15,10 +15,15 @@
 package audit
 
 import (
+	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"golang.org/x/mod/sumdb/note"
 	"golang.org/x/mod/sumdb/tlog"
 )
 
@@ -48,7 +53,7 @@ kn9DgqDhXzoZMM8828SQsbuovr/WRn7QfFd5Qe1rpwA=
 
 func TestLeavesAtOffset(t *testing.T) {
 	sumdb := &SumDBClient{
-		vkey:   "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8",
+		vkeys:  []string{"sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8"},
 		height: 2,
 		fetcher: &FakeFetcher{
 			values: map[string]string{"/tile/2/data/000": leafData},
@@ -74,7 +79,7 @@ func TestLeavesAtOffset(t *testing.T) {
 
 func TestLatestCheckpoint(t *testing.T) {
 	sumdb := &SumDBClient{
-		vkey:   "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8",
+		vkeys:  []string{"sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8"},
 		height: 2,
 		fetcher: &FakeFetcher{
 			values: map[string]string{"/latest": checkpointData},
@@ -102,7 +107,7 @@ func TestTileHashes(t *testing.T) {
 		t.Fatalf("failed to decode hash data: %v", err)
 	}
 	sumdb := &SumDBClient{
-		vkey:   "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8",
+		vkeys:  []string{"sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8"},
 		height: 2,
 		fetcher: &FakeFetcher{
 			values: map[string]string{"/tile/2/0/000": string(hashData)},
@@ -117,6 +122,53 @@ func TestTileHashes(t *testing.T) {
 	}
 }
 
+func TestHTTPFetcherConditionalRequests(t *testing.T) {
+	var requests, notModified int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/latest" && r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprintf(w, "data for %s", r.URL.Path)
+	}))
+	defer ts.Close()
+
+	f := NewHTTPFetcher(ts.URL, HTTPOptions{RequestsPerSecond: 1000, BytesPerSecond: 1 << 20})
+	for _, path := range []string{"/latest", "/latest", "/tile/2/0/000", "/tile/2/0/000"} {
+		data, err := f.GetData(path)
+		if err != nil {
+			t.Fatalf("GetData(%q): %v", path, err)
+		}
+		if got, want := string(data), "data for "+path; got != want {
+			t.Errorf("GetData(%q): got %q, want %q", path, got, want)
+		}
+	}
+	if got, want := requests, 4; got != want {
+		t.Errorf("got %d requests, want %d", got, want)
+	}
+	// Only the second request for the mutable checkpoint should be conditional.
+	if got, want := notModified, 1; got != want {
+		t.Errorf("got %d not modified responses, want %d", got, want)
+	}
+}
+
+func TestHTTPFetcherTimeout(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	f := NewHTTPFetcher(ts.URL, HTTPOptions{Timeout: 50 * time.Millisecond})
+	if _, err := f.GetData("/latest"); err == nil {
+		t.Error("expected error when the server does not respond")
+	}
+}
+
 type FakeFetcher struct {
 	values map[string]string
 }
@@ -128,3 +180,74 @@ func (f *FakeFetcher) GetData(path string) ([]byte, error) {
 	}
 	return []byte(res), nil
 }
+
+func TestParseCheckpointNoteKeys(t *testing.T) {
+	oldSKey, oldVKey, err := note.GenerateKey(rand.Reader, "sumdb.example.com")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	newSKey, newVKey, err := note.GenerateKey(rand.Reader, "sumdb.example.com")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	otherSKey, _, err := note.GenerateKey(rand.Reader, "other.example.com")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	sign := func(skey string) []byte {
+		signer, err := note.NewSigner(skey)
+		if err != nil {
+			t.Fatalf("NewSigner: %v", err)
+		}
+		msg, err := note.Sign(&note.Note{Text: "go.sum database tree\n10\nAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=\n"}, signer)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		return msg
+	}
+
+	sumdb, err := NewSumDBWithKeys(2, []string{oldVKey, newVKey}, HTTPOptions{})
+	if err != nil {
+		t.Fatalf("NewSumDBWithKeys: %v", err)
+	}
+	for _, test := range []struct {
+		name    string
+		note    []byte
+		wantKey string
+	}{
+		{name: "old key", note: sign(oldSKey), wantKey: oldVKey},
+		{name: "new key", note: sign(newSKey), wantKey: newVKey},
+		{name: "unknown key", note: sign(otherSKey)},
+		{name: "unsigned", note: []byte("go.sum database tree\n10\nAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=\n\n")},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cp, err := sumdb.ParseCheckpointNote(test.note)
+			if len(test.wantKey) == 0 {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCheckpointNote: %v", err)
+			}
+			if got, want := cp.VerifierKey, test.wantKey; got != want {
+				t.Errorf("got key %q, want %q", got, want)
+			}
+		})
+	}
+
+	if _, err := NewSumDBWithKeys(2, []string{oldVKey, "other.example.com+12345678+AQ"}, HTTPOptions{}); err == nil {
+		t.Error("expected error for keys with different names")
+	}
+	if _, err := NewSumDBWithKeys(2, nil, HTTPOptions{}); err == nil {
+		t.Error("expected error for no keys")
+	}
+}
+
+func TestSplitVerifierKeys(t *testing.T) {
+	got := SplitVerifierKeys(" a+1+x, b+2+y,,")
+	if len(got) != 2 || got[0] != "a+1+x" || got[1] != "b+2+y" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -16,25 +16,73 @@ package main
 
 import (
 	"context"
-
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/google/trillian-examples/sumdbaudit/audit"
+	"github.com/google/trillian/monitoring"
+	"github.com/google/trillian/monitoring/prometheus"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	height            = flag.Int("h", 8, "tile height")
+	vkey              = flag.String("k", "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8", "comma separated verifier keys of the SumDB")
+	dbDriver          = flag.String("db_driver", audit.DriverSQLite, "database driver to use; sqlite3 or postgres")
+	db                = flag.String("db", "./sum.db", "database file location (will be created if it doesn't exist), or connection string if using postgres")
+	extraV            = flag.Bool("x", false, "performs additional checks on each tile hashes")
+	workers           = flag.Int("workers", 4, "number of tiles to fetch from SumDB in parallel")
+	proxy             = flag.String("proxy", "", "URL of an http, https or socks5 proxy to fetch data from SumDB through; if empty the proxy environment variables are used")
+	socksProxy        = flag.String("socks_proxy", "", "host:port of a SOCKS5 proxy to fetch data from SumDB through, e.g. localhost:9050 for a local Tor client; host names are resolved by the proxy so DNS lookups are also routed through it. Cannot be used with --proxy")
+	maxQPS            = flag.Float64("max_qps", 0, "maximum number of requests per second to make to SumDB, or 0 for no limit")
+	maxBandwidth      = flag.Int("max_bandwidth", 0, "maximum bytes per second to download from SumDB, or 0 for no limit")
+	httpTimeout       = flag.Duration("http_timeout", audit.DefaultHTTPTimeout, "maximum time for each request to SumDB, after which it is abandoned and retried")
+	pollInterval      = flag.Duration("poll_interval", 0, "if non-zero, keeps running and checks for a new checkpoint at this interval")
+	metricsEndpoint   = flag.String("metrics_endpoint", "", "endpoint for serving metrics; only used with --poll_interval")
+	statusEndpoint    = flag.String("status_endpoint", "", "endpoint for serving a status page showing the progress of the current operation")
+	onVerifiedExec    = flag.String("on_verified_exec", "", "shell command to run after each new checkpoint is verified; see audit.CommandHook for the environment it is given")
+	onVerifiedWebhook = flag.String("on_verified_webhook", "", "URL to POST a JSON description of each new checkpoint to after it is verified")
+	hookTimeout       = flag.Duration("hook_timeout", audit.DefaultHookTimeout, "maximum time to wait for --on_verified_exec or --on_verified_webhook to handle each checkpoint")
+	retainLeaves      = flag.Int64("retain_leaves", -1, "if non-negative, drops the raw data of older leaves once verified and processed, keeping at least this many of the most recent leaves; dropped leaves are fetched from SumDB again if needed")
+	progressInterval  = flag.Duration("progress_interval", 30*time.Second, "interval at which to log the progress of the current operation, or 0 to disable")
+	pinCheckpoint     = flag.String("pin_checkpoint", "", "file containing a signed checkpoint note from the SumDB, which every checkpoint cloned must be consistent with")
+)
+
+var (
+	hooks  []audit.Hook
+	pinned *audit.Checkpoint
 )
 
 var (
-	height = flag.Int("h", 8, "tile height")
-	vkey   = flag.String("k", "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8", "key")
-	db     = flag.String("db", "./sum.db", "database file location (will be created if it doesn't exist)")
-	extraV = flag.Bool("x", false, "performs additional checks on each tile hashes")
+	latestTreeSize     monitoring.Gauge
+	verifiedTreeSize   monitoring.Gauge
+	verifiedTimestamp  monitoring.Gauge
+	syncFailureCounter monitoring.Counter
 )
 
+// setupMetrics initializes all the exported metrics.
+func setupMetrics(mf monitoring.MetricFactory) {
+	latestTreeSize = mf.NewGauge("latest_treesize", "Size of tree at the latest checkpoint fetched from SumDB")
+	verifiedTreeSize = mf.NewGauge("verified_treesize", "Size of tree at the last verified checkpoint")
+	verifiedTimestamp = mf.NewGauge("verified_timestamp", "Time of last successful verification in ms since epoch")
+	syncFailureCounter = mf.NewCounter("sync_failures", "Number of failed attempts to sync with SumDB")
+}
+
 // Clones the leaves of the SumDB into the local database and verifies the result.
-// This does not perform any checks on the leaf data to look for inconsistent claims.
 // If this returns successfully, it means that all leaf data in the DB matches that
-// contained in the SumDB.
+// contained in the SumDB, that the SumDB is consistent with the checkpoint that
+// was previously verified, and that no module+version has conflicting hashes.
+// With --poll_interval this keeps running, and syncs with the SumDB periodically.
 func main() {
 	ctx := context.Background()
 
@@ -42,7 +90,7 @@ func main() {
 	log.SetFlags(0)
 	flag.Parse()
 
-	db, err := audit.NewDatabase(*db)
+	db, err := audit.NewDatabaseWithDriver(*dbDriver, *db)
 	if err != nil {
 		log.Fatalf("failed to open DB: %v", err)
 	}
@@ -51,37 +99,201 @@ func main() {
 		log.Fatalf("failed to init DB: %v", err)
 	}
 
-	sumDB := audit.NewSumDB(*height, *vkey)
+	opts := audit.HTTPOptions{
+		RequestsPerSecond: *maxQPS,
+		BytesPerSecond:    *maxBandwidth,
+		Timeout:           *httpTimeout,
+	}
+	if len(*proxy) > 0 {
+		if opts.ProxyURL, err = url.Parse(*proxy); err != nil {
+			log.Fatalf("invalid --proxy: %v", err)
+		}
+	}
+	if len(*socksProxy) > 0 {
+		if opts.ProxyURL != nil {
+			log.Fatal("--proxy and --socks_proxy cannot both be set")
+		}
+		opts.ProxyURL = &url.URL{Scheme: "socks5", Host: *socksProxy}
+	}
+	sumDB, err := audit.NewSumDBWithKeys(*height, audit.SplitVerifierKeys(*vkey), opts)
+	if err != nil {
+		log.Fatalf("invalid -k: %v", err)
+	}
+	s := audit.NewService(db, sumDB, *height)
+	if len(*pinCheckpoint) > 0 {
+		raw, err := ioutil.ReadFile(*pinCheckpoint)
+		if err != nil {
+			log.Fatalf("failed to read --pin_checkpoint: %v", err)
+		}
+		if pinned, err = sumDB.ParseCheckpointNote(raw); err != nil {
+			log.Fatalf("invalid --pin_checkpoint: %v", err)
+		}
+	}
+	if len(*onVerifiedExec) > 0 {
+		hooks = append(hooks, audit.CommandHook{Command: *onVerifiedExec, Timeout: *hookTimeout})
+	}
+	if len(*onVerifiedWebhook) > 0 {
+		hooks = append(hooks, audit.WebhookHook{URL: *onVerifiedWebhook, Timeout: *hookTimeout})
+	}
+
+	if *statusEndpoint != "" {
+		// Run a separate handler for the status page.
+		go func() {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+				p := s.Progress()
+				if r.URL.Query().Get("format") == "json" {
+					w.Header().Set("Content-Type", "application/json")
+					json.NewEncoder(w).Encode(p)
+					return
+				}
+				fmt.Fprintln(w, p)
+			})
+			statusServer := http.Server{Addr: *statusEndpoint, Handler: mux}
+			err := statusServer.ListenAndServe()
+			log.Printf("Status server exited: %v", err)
+		}()
+	}
+	if *progressInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(*progressInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				log.Printf("Progress: %s", s.Progress())
+			}
+		}()
+	}
+
+	if *pollInterval == 0 {
+		setupMetrics(monitoring.InertMetricFactory{})
+		if err := cloneAndVerify(ctx, db, sumDB, s); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	log.SetFlags(log.LstdFlags)
+	setupMetrics(prometheus.MetricFactory{})
+	if *metricsEndpoint != "" {
+		// Run a separate handler for metrics.
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.Handler())
+			metricsServer := http.Server{Addr: *metricsEndpoint, Handler: mux}
+			err := metricsServer.ListenAndServe()
+			log.Printf("Metrics server exited: %v", err)
+		}()
+	}
+
+	ticker := time.NewTicker(*pollInterval)
+	defer ticker.Stop()
+	for {
+		if err := cloneAndVerify(ctx, db, sumDB, s); err != nil {
+			var ie *audit.IntegrityError
+			if errors.As(err, &ie) {
+				log.Fatalf("SumDB failed verification: %v", err)
+			}
+			syncFailureCounter.Inc()
+			log.Printf("Failed to sync, will retry in %v: %v", *pollInterval, err)
+		}
+		<-ticker.C
+	}
+}
+
+// cloneAndVerify clones and verifies the latest checkpoint from the SumDB.
+// Errors which may be transient are returned to be retried, and any evidence
+// that the SumDB has violated its claims is returned as an audit.IntegrityError.
+func cloneAndVerify(ctx context.Context, db *audit.Database, sumDB *audit.SumDBClient, s *audit.Service) error {
+	golden, err := db.GoldenCheckpoint(sumDB.ParseStoredCheckpoint)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
 	checkpoint, err := sumDB.LatestCheckpoint()
 	if err != nil {
-		log.Fatalf("failed to get latest checkpoint: %s", err)
+		return err
+	}
+	latestTreeSize.Set(float64(checkpoint.N))
+	// Check the SumDB has only appended to trusted checkpoints before spending
+	// any effort on cloning.
+	for _, trusted := range []*audit.Checkpoint{golden, pinned} {
+		if trusted == nil {
+			continue
+		}
+		if err := s.CheckSumDBConsistency(trusted, checkpoint); err != nil {
+			return fmt.Errorf("CheckSumDBConsistency: %w", err)
+		}
+	}
+
+	if golden != nil && golden.N == checkpoint.N && golden.Hash == checkpoint.Hash {
+		log.Printf("No new checkpoint since tree size %d", checkpoint.N)
+		verifiedTimestamp.Set(float64(time.Now().UnixNano() / int64(time.Millisecond)))
+		return nil
 	}
 
 	log.Printf("Got SumDB checkpoint for %d entries. Downloading...", checkpoint.N)
-	s := audit.NewService(db, sumDB, *height)
-	if err := s.CloneLeafTiles(ctx, checkpoint); err != nil {
-		log.Fatalf("failed to update leaves: %v", err)
+	if err := s.CloneLeafTiles(ctx, &checkpoint.Tree, *workers); err != nil {
+		return err
 	}
 	log.Printf("Updated leaves to latest checkpoint (tree size %d). Calculating hashes...", checkpoint.N)
 
-	if err := s.HashTiles(ctx, checkpoint); err != nil {
-		log.Fatalf("HashTiles: %v", err)
+	if err := s.HashTiles(ctx, &checkpoint.Tree); err != nil {
+		return fmt.Errorf("HashTiles: %w", err)
 	}
 	log.Printf("Hashes updated successfully. Checking root hash...")
-	if err := s.CheckRootHash(ctx, checkpoint); err != nil {
-		log.Fatalf("CheckRootHash: %v", err)
+	if err := s.CheckRootHash(ctx, &checkpoint.Tree); err != nil {
+		return fmt.Errorf("CheckRootHash: %w", err)
+	}
+	if golden != nil {
+		log.Printf("Checking consistency with previous checkpoint (tree size %d)...", golden.N)
+		if err := s.CheckConsistency(&golden.Tree, &checkpoint.Tree); err != nil {
+			return fmt.Errorf("CheckConsistency: %w", err)
+		}
 	}
 	log.Printf("Cloned successfully. Tree size is %d, hash is %x (%s). Processing data...", checkpoint.N, checkpoint.Hash[:], checkpoint.Hash)
 
-	if err := s.ProcessMetadata(ctx, checkpoint); err != nil {
-		log.Fatalf("ProcessMetadata: %v", err)
+	if err := s.ProcessMetadata(ctx, &checkpoint.Tree); err != nil {
+		return err
+	}
+	log.Printf("Leaf data processed. Checking for duplicates...")
+	dups, err := s.FindDuplicates(ctx)
+	if err != nil {
+		return err
+	}
+	for _, d := range dups {
+		if d.Conflicting() {
+			return &audit.IntegrityError{Err: fmt.Errorf("found conflicting hashes for %s@%s", d.Module, d.Version)}
+		}
+	}
+	log.Printf("No conflicting hashes found (%d duplicates).", len(dups))
+	if *retainLeaves >= 0 {
+		if err := s.PruneLeaves(&checkpoint.Tree, *retainLeaves); err != nil {
+			return err
+		}
+		log.Printf("Pruned leaf data, retaining at least %d leaves.", *retainLeaves)
 	}
-	log.Printf("Leaf data processed.")
 	if *extraV {
 		log.Printf("Performing extra validation on tiles...")
-		if err := s.VerifyTiles(ctx, checkpoint); err != nil {
-			log.Fatalf("VerifyTiles: %v", err)
+		if err := s.VerifyTiles(ctx, &checkpoint.Tree); err != nil {
+			return fmt.Errorf("VerifyTiles: %w", err)
 		}
 		log.Printf("Tile verificaton passed")
 	}
+
+	// The checkpoint is only recorded once everything above has succeeded, so
+	// that a run which fails part way is repeated in full next time, rather
+	// than skipped as having no new checkpoint.
+	if err := db.SetGoldenCheckpoint(checkpoint); err != nil {
+		return err
+	}
+	verifiedTreeSize.Set(float64(checkpoint.N))
+	verifiedTimestamp.Set(float64(time.Now().UnixNano() / int64(time.Millisecond)))
+	advancement := audit.NewAdvancement(golden, checkpoint)
+	for _, h := range hooks {
+		// The checkpoint is already verified, so hook failures are not retried.
+		if err := h.Notify(ctx, advancement); err != nil {
+			log.Printf("Hook failed for tree size %d: %v", checkpoint.N, err)
+		}
+	}
+	log.Printf("Verified checkpoint for tree size %d.", checkpoint.N)
+	return nil
 }
@@ -0,0 +1,185 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/trillian-examples/sumdbaudit/audit"
+	"github.com/google/trillian/monitoring"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// testSumDB serves the tiles and latest checkpoint of a log of the given
+// leaves, using tiles of height 2. It returns a client for it, and a function
+// to stop serving.
+func testSumDB(t *testing.T, leaves []string) (*audit.SumDBClient, func()) {
+	t.Helper()
+	skey, vkey, err := note.GenerateKey(rand.Reader, "sumdb.example.com")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	var stored []tlog.Hash
+	hashes := tlog.HashReaderFunc(func(indexes []int64) ([]tlog.Hash, error) {
+		r := make([]tlog.Hash, len(indexes))
+		for i, x := range indexes {
+			r[i] = stored[x]
+		}
+		return r, nil
+	})
+	for i, l := range leaves {
+		hs, err := tlog.StoredHashes(int64(i), []byte(l), hashes)
+		if err != nil {
+			t.Fatalf("StoredHashes: %v", err)
+		}
+		stored = append(stored, hs...)
+	}
+
+	size := int64(len(leaves))
+	values := make(map[string][]byte)
+	for n := int64(1); n <= size; n++ {
+		for _, tile := range tlog.NewTiles(2, n-1, n) {
+			data, err := tlog.ReadTileData(tile, hashes)
+			if err != nil {
+				t.Fatalf("ReadTileData(%s): %v", tile.Path(), err)
+			}
+			values["/"+tile.Path()] = data
+			if tile.L == 0 {
+				start := tile.N << uint(tile.H)
+				tile.L = -1
+				values["/"+tile.Path()] = []byte(strings.Join(leaves[start:start+int64(tile.W)], "\n"))
+			}
+		}
+	}
+	hash, err := tlog.TreeHash(size, hashes)
+	if err != nil {
+		t.Fatalf("TreeHash: %v", err)
+	}
+	if values["/latest"], err = note.Sign(&note.Note{Text: string(tlog.FormatTree(tlog.Tree{N: size, Hash: hash}))}, signer); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := values[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	sumDB, err := audit.NewSumDBWithKeys(2, []string{vkey}, audit.HTTPOptions{BaseURL: ts.URL})
+	if err != nil {
+		t.Fatalf("NewSumDBWithKeys: %v", err)
+	}
+	return sumDB, ts.Close
+}
+
+// moduleLeaves returns count leaves, each recording a different module version.
+func moduleLeaves(count int) []string {
+	var leaves []string
+	for i := 0; i < count; i++ {
+		leaves = append(leaves, fmt.Sprintf("example.com/m v1.0.%d h1:repo%d=\nexample.com/m v1.0.%d/go.mod h1:mod%d=\n", i, i, i, i))
+	}
+	return leaves
+}
+
+// recordingHook records every Advancement it is notified of.
+type recordingHook struct {
+	notified []audit.Advancement
+}
+
+func (h *recordingHook) Notify(ctx context.Context, a audit.Advancement) error {
+	h.notified = append(h.notified, a)
+	return nil
+}
+
+func TestCloneAndVerify(t *testing.T) {
+	setupMetrics(monitoring.InertMetricFactory{})
+	conflicting := moduleLeaves(9)
+	conflicting[6] = strings.Replace(conflicting[2], "h1:repo2", "h1:evil", 1)
+
+	for _, test := range []struct {
+		name          string
+		leaves        []string
+		wantIntegrity bool
+	}{
+		{name: "valid", leaves: moduleLeaves(9)},
+		{name: "conflicting hashes", leaves: conflicting, wantIntegrity: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "clone")
+			if err != nil {
+				t.Fatalf("TempDir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			db, err := audit.NewDatabase(filepath.Join(dir, "sum.db"))
+			if err != nil {
+				t.Fatalf("NewDatabase: %v", err)
+			}
+			if err := db.Init(); err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+			sumDB, stop := testSumDB(t, test.leaves)
+			defer stop()
+			s := audit.NewService(db, sumDB, 2)
+			hook := &recordingHook{}
+			hooks = []audit.Hook{hook}
+			defer func() { hooks = nil }()
+
+			// Running again at the same checkpoint must repeat any failure,
+			// rather than skipping the checkpoint as already verified.
+			for run := 0; run < 2; run++ {
+				err := cloneAndVerify(context.Background(), db, sumDB, s)
+				var ie *audit.IntegrityError
+				if got := errors.As(err, &ie); got != test.wantIntegrity {
+					t.Fatalf("run %d: got error %v, want IntegrityError %t", run, err, test.wantIntegrity)
+				}
+				if !test.wantIntegrity && err != nil {
+					t.Fatalf("run %d: %v", run, err)
+				}
+			}
+
+			// Hooks are only told about checkpoints which pass every check,
+			// and only the first time they are verified.
+			wantNotified := 1
+			if test.wantIntegrity {
+				wantNotified = 0
+			}
+			if got := len(hook.notified); got != wantNotified {
+				t.Errorf("hook notified %d times, want %d", got, wantNotified)
+			}
+			_, err = db.GoldenCheckpoint(sumDB.ParseStoredCheckpoint)
+			if got, want := err == sql.ErrNoRows, test.wantIntegrity; got != want {
+				t.Errorf("GoldenCheckpoint: got error %v, want no checkpoint %t", err, want)
+			}
+		})
+	}
+}
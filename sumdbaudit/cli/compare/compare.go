@@ -0,0 +1,119 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/google/trillian-examples/sumdbaudit/audit"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	height       = flag.Int("h", 8, "tile height")
+	vkey         = flag.String("k", "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8", "comma separated verifier keys of the SumDB")
+	dbDriver     = flag.String("db_driver", audit.DriverSQLite, "database driver to use; sqlite3 or postgres")
+	db           = flag.String("db", "./sum.db", "database file location (will be created if it doesn't exist), or connection string if using postgres")
+	urlA         = flag.String("url_a", "", "base URL of the first SumDB endpoint; if empty the SumDB is accessed directly")
+	proxyA       = flag.String("proxy_a", "", "URL of an http, https or socks5 proxy to fetch data from the first endpoint through")
+	urlB         = flag.String("url_b", "https://proxy.golang.org/sumdb/sum.golang.org", "base URL of the second SumDB endpoint; if empty the SumDB is accessed directly")
+	proxyB       = flag.String("proxy_b", "", "URL of an http, https or socks5 proxy to fetch data from the second endpoint through")
+	pollInterval = flag.Duration("poll_interval", 0, "if non-zero, keeps running and compares the endpoints at this interval")
+)
+
+// Compares the latest checkpoints served by two SumDB endpoints, and checks that
+// they are consistent with each other. The endpoints can be different servers,
+// or the same server accessed via different network paths. Any split view found
+// is recorded in the database and causes the process to exit.
+func main() {
+	log.SetPrefix("compare: ")
+	log.SetFlags(0)
+	flag.Parse()
+
+	db, err := audit.NewDatabaseWithDriver(*dbDriver, *db)
+	if err != nil {
+		log.Fatalf("failed to open DB: %v", err)
+	}
+	err = db.Init()
+	if err != nil {
+		log.Fatalf("failed to init DB: %v", err)
+	}
+
+	a := newSumDB("a", *urlA, *proxyA)
+	b := newSumDB("b", *urlB, *proxyB)
+
+	if *pollInterval == 0 {
+		if err := compare(db, a, b); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	log.SetFlags(log.LstdFlags)
+	ticker := time.NewTicker(*pollInterval)
+	defer ticker.Stop()
+	for {
+		if err := compare(db, a, b); err != nil {
+			log.Printf("Failed to compare, will retry in %v: %v", *pollInterval, err)
+		}
+		<-ticker.C
+	}
+}
+
+func newSumDB(name, baseURL, proxy string) *audit.SumDBClient {
+	opts := audit.HTTPOptions{BaseURL: baseURL}
+	if len(proxy) > 0 {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			log.Fatalf("invalid --proxy_%s: %v", name, err)
+		}
+		opts.ProxyURL = u
+	}
+	sumDB, err := audit.NewSumDBWithKeys(*height, audit.SplitVerifierKeys(*vkey), opts)
+	if err != nil {
+		log.Fatalf("invalid -k: %v", err)
+	}
+	return sumDB
+}
+
+// compare fetches the latest checkpoint from each endpoint and checks that they
+// are consistent. Errors which may be transient are returned, but if a split
+// view is found then it is recorded and the process exits.
+func compare(db *audit.Database, a, b *audit.SumDBClient) error {
+	cpA, err := a.LatestCheckpoint()
+	if err != nil {
+		return err
+	}
+	cpB, err := b.LatestCheckpoint()
+	if err != nil {
+		return err
+	}
+	split, err := audit.CompareCheckpoints(cpA, cpB, a, b)
+	if err != nil {
+		return err
+	}
+	if split != nil {
+		if err := db.RecordSplitView(split); err != nil {
+			log.Printf("Failed to record split view: %v", err)
+		}
+		log.Fatalf("Found split view: %s\n\nCheckpoint A:\n%s\nCheckpoint B:\n%s", split, split.A.Raw, split.B.Raw)
+	}
+	log.Printf("Checkpoints are consistent (tree sizes %d and %d)", cpA.N, cpB.N)
+	return nil
+}
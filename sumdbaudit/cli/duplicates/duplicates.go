@@ -0,0 +1,109 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/google/trillian-examples/sumdbaudit/audit"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/mod/sumdb/note"
+)
+
+var (
+	height   = flag.Int("h", 8, "tile height")
+	vkey     = flag.String("k", "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8", "comma separated verifier keys of the SumDB")
+	dbDriver = flag.String("db_driver", audit.DriverSQLite, "database driver to use; sqlite3 or postgres")
+	db       = flag.String("db", "./sum.db", "database file location, or connection string if using postgres")
+	skeyFile = flag.String("skey_file", "", "file containing the note signer key for the report; if empty no report is written")
+	out      = flag.String("out", "./duplicates.report", "file to write the signed report to")
+)
+
+// Checks a local clone created by the clone tool for any module+version which
+// appears more than once in the log, and optionally writes a signed report of
+// the findings. Exits with an error if any module+version has been recorded
+// with conflicting hashes.
+func main() {
+	ctx := context.Background()
+
+	log.SetPrefix("duplicates: ")
+	log.SetFlags(0)
+	flag.Parse()
+
+	db, err := audit.NewDatabaseWithDriver(*dbDriver, *db)
+	if err != nil {
+		log.Fatalf("failed to open DB: %v", err)
+	}
+	sumDB, err := audit.NewSumDBWithKeys(*height, audit.SplitVerifierKeys(*vkey), audit.HTTPOptions{})
+	if err != nil {
+		log.Fatalf("invalid -k: %v", err)
+	}
+	checkpoint, err := db.GoldenCheckpoint(sumDB.ParseStoredCheckpoint)
+	if err != nil {
+		log.Fatalf("failed to get verified checkpoint: %v", err)
+	}
+
+	s := audit.NewService(db, sumDB, *height)
+	dups, err := s.FindDuplicates(ctx)
+	if err != nil {
+		log.Fatalf("FindDuplicates: %v", err)
+	}
+	conflicts := 0
+	for _, d := range dups {
+		if d.Conflicting() {
+			conflicts++
+			log.Printf("CONFLICT: %s@%s has different hashes in leaves %v", d.Module, d.Version, indices(d))
+		} else {
+			log.Printf("Duplicate: %s@%s appears in leaves %v", d.Module, d.Version, indices(d))
+		}
+	}
+
+	if len(*skeyFile) > 0 {
+		skey, err := ioutil.ReadFile(*skeyFile)
+		if err != nil {
+			log.Fatalf("failed to read signer key: %v", err)
+		}
+		signer, err := note.NewSigner(strings.TrimSpace(string(skey)))
+		if err != nil {
+			log.Fatalf("failed to create signer: %v", err)
+		}
+		report, err := audit.SignedDuplicatesReport(&checkpoint.Tree, dups, signer)
+		if err != nil {
+			log.Fatalf("failed to create report: %v", err)
+		}
+		if err := ioutil.WriteFile(*out, report, 0644); err != nil {
+			log.Fatalf("failed to write report: %v", err)
+		}
+		log.Printf("Signed report written to %s", *out)
+	}
+
+	if conflicts > 0 {
+		log.Fatalf("Found %d module versions with conflicting hashes in tree size %d", conflicts, checkpoint.N)
+	}
+	log.Printf("No conflicting hashes found in tree size %d (%d duplicates)", checkpoint.N, len(dups))
+}
+
+func indices(d audit.Duplicate) []int64 {
+	res := make([]int64, len(d.Leaves))
+	for i, l := range d.Leaves {
+		res[i] = l.Index
+	}
+	return res
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/google/trillian-examples/sumdbaudit/audit"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+var (
+	height   = flag.Int("h", 8, "tile height")
+	vkey     = flag.String("k", "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8", "comma separated verifier keys of the SumDB")
+	dbDriver = flag.String("db_driver", audit.DriverSQLite, "database driver to use; sqlite3 or postgres")
+	db       = flag.String("db", "./sum.db", "database file location, or connection string if using postgres")
+	outDir   = flag.String("out", "./sumdb", "directory to write the tiles and checkpoint to")
+)
+
+// Exports a local clone created by the clone tool as a directory of tlog tile
+// files laid out in the same way as the SumDB serves them, along with the last
+// verified checkpoint in a file named "latest". This allows the clone to be
+// consumed by tools which understand the tlog format, without SQL access.
+func main() {
+	ctx := context.Background()
+
+	log.SetPrefix("export: ")
+	log.SetFlags(0)
+	flag.Parse()
+
+	db, err := audit.NewDatabaseWithDriver(*dbDriver, *db)
+	if err != nil {
+		log.Fatalf("failed to open DB: %v", err)
+	}
+	sumDB, err := audit.NewSumDBWithKeys(*height, audit.SplitVerifierKeys(*vkey), audit.HTTPOptions{})
+	if err != nil {
+		log.Fatalf("invalid -k: %v", err)
+	}
+	checkpoint, err := db.GoldenCheckpoint(sumDB.ParseStoredCheckpoint)
+	if err != nil {
+		log.Fatalf("failed to get verified checkpoint: %v", err)
+	}
+
+	log.Printf("Exporting tiles for tree size %d to %s...", checkpoint.N, *outDir)
+	s := audit.NewService(db, sumDB, *height)
+	err = s.ExportTiles(ctx, &checkpoint.Tree, func(t tlog.Tile, data []byte) error {
+		return writeFile(filepath.Join(*outDir, filepath.FromSlash(t.Path())), data)
+	})
+	if err != nil {
+		log.Fatalf("ExportTiles: %v", err)
+	}
+	// The checkpoint is written last so that it only refers to tiles which exist.
+	if err := writeFile(filepath.Join(*outDir, "latest"), checkpoint.Raw); err != nil {
+		log.Fatalf("failed to write checkpoint: %v", err)
+	}
+	log.Printf("Export complete.")
+}
+
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/trillian-examples/sumdbaudit/audit"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+var (
+	height   = flag.Int("h", 8, "tile height")
+	vkey     = flag.String("k", "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8", "comma separated verifier keys of the SumDB")
+	dbDriver = flag.String("db_driver", audit.DriverSQLite, "database driver to use; sqlite3 or postgres")
+	db       = flag.String("db", "./sum.db", "database file location, or connection string if using postgres")
+)
+
+// Looks up a module@version in a local clone created by the clone tool, and
+// prints the hashes recorded for it along with an inclusion proof for the leaf
+// in the last verified checkpoint. The proof is calculated and checked using
+// only local data, so this can be used as an offline go.sum check.
+func main() {
+	log.SetPrefix("lookup: ")
+	log.SetFlags(0)
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		log.Fatalf("usage: lookup [flags] module@version")
+	}
+	module, version := splitModuleVersion(flag.Arg(0))
+	if len(module) == 0 || len(version) == 0 {
+		log.Fatalf("expected module@version but got %q", flag.Arg(0))
+	}
+
+	db, err := audit.NewDatabaseWithDriver(*dbDriver, *db)
+	if err != nil {
+		log.Fatalf("failed to open DB: %v", err)
+	}
+	sumDB, err := audit.NewSumDBWithKeys(*height, audit.SplitVerifierKeys(*vkey), audit.HTTPOptions{})
+	if err != nil {
+		log.Fatalf("invalid -k: %v", err)
+	}
+	checkpoint, err := db.GoldenCheckpoint(sumDB.ParseStoredCheckpoint)
+	if err != nil {
+		log.Fatalf("failed to get verified checkpoint: %v", err)
+	}
+
+	metadata, err := db.LookupMetadata(module, version)
+	if err != nil {
+		log.Fatalf("failed to look up metadata: %v", err)
+	}
+	if len(metadata) == 0 {
+		log.Fatalf("%s@%s not found in local clone", module, version)
+	}
+	if len(metadata) > 1 {
+		log.Printf("WARNING: %s@%s appears %d times in the log", module, version, len(metadata))
+	}
+
+	s := audit.NewService(db, sumDB, *height)
+	for _, m := range metadata {
+		leaves, err := s.Leaves(m.Index, 1)
+		if err != nil {
+			log.Fatalf("failed to get leaf %d: %v", m.Index, err)
+		}
+		proof, err := s.InclusionProof(&checkpoint.Tree, m.Index)
+		if err != nil {
+			log.Fatalf("failed to calculate inclusion proof for leaf %d: %v", m.Index, err)
+		}
+		if err := tlog.CheckRecord(proof, checkpoint.N, checkpoint.Hash, m.Index, tlog.RecordHash(leaves[0])); err != nil {
+			log.Fatalf("inclusion proof for leaf %d failed to verify: %v", m.Index, err)
+		}
+
+		fmt.Printf("%s %s %s\n", m.Module, m.Version, m.RepoHash)
+		fmt.Printf("%s %s/go.mod %s\n", m.Module, m.Version, m.ModHash)
+		fmt.Printf("\nLeaf index %d is included in tree size %d with proof:\n", m.Index, checkpoint.N)
+		for _, h := range proof {
+			fmt.Printf("%s\n", h)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("%s", checkpoint.Raw)
+}
+
+// splitModuleVersion splits a string of the form module@version.
+func splitModuleVersion(mv string) (string, string) {
+	i := strings.LastIndex(mv, "@")
+	if i < 0 {
+		return mv, ""
+	}
+	return mv[:i], mv[i+1:]
+}
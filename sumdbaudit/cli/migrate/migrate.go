@@ -0,0 +1,61 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/google/trillian-examples/sumdbaudit/audit"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	dbDriver = flag.String("db_driver", audit.DriverSQLite, "database driver to use; sqlite3 or postgres")
+	db       = flag.String("db", "./sum.db", "database file location, or connection string if using postgres")
+	to       = flag.Int("to", -1, "schema version to migrate to; defaults to the latest version")
+)
+
+// Migrates the schema of a local clone to the given version. The clone tool
+// migrates to the latest version automatically, so this is only needed to
+// revert to an older version, e.g. before rolling back to an older release.
+func main() {
+	log.SetPrefix("migrate: ")
+	log.SetFlags(0)
+	flag.Parse()
+
+	db, err := audit.NewDatabaseWithDriver(*dbDriver, *db)
+	if err != nil {
+		log.Fatalf("failed to open DB: %v", err)
+	}
+	from, err := db.SchemaVersion()
+	if err != nil {
+		log.Fatalf("failed to get schema version: %v", err)
+	}
+	if *to < 0 {
+		err = db.Init()
+	} else {
+		err = db.Migrate(*to)
+	}
+	if err != nil {
+		log.Fatalf("failed to migrate: %v", err)
+	}
+	version, err := db.SchemaVersion()
+	if err != nil {
+		log.Fatalf("failed to get schema version: %v", err)
+	}
+	log.Printf("Migrated schema from version %d to %d", from, version)
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/google/trillian-examples/sumdbaudit/audit"
+	"github.com/google/trillian-examples/sumdbaudit/mirror"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	height   = flag.Int("h", 8, "tile height")
+	vkey     = flag.String("k", "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8", "comma separated verifier keys of the SumDB")
+	dbDriver = flag.String("db_driver", audit.DriverSQLite, "database driver to use; sqlite3 or postgres")
+	db       = flag.String("db", "./sum.db", "database file location, or connection string if using postgres")
+	keysFile = flag.String("keys_file", "./mirror.keys", "file containing the key ring used to cosign checkpoints (see mirrorkeys)")
+	listen   = flag.String("listen", ":8080", "address to serve the mirror on")
+)
+
+// Serves a local clone created by the clone tool using the same API as the
+// SumDB. The checkpoint is cosigned by all of the active keys in the key ring,
+// which is read on startup.
+func main() {
+	log.SetPrefix("mirror: ")
+	log.SetFlags(0)
+	flag.Parse()
+
+	db, err := audit.NewDatabaseWithDriver(*dbDriver, *db)
+	if err != nil {
+		log.Fatalf("failed to open DB: %v", err)
+	}
+	keyData, err := ioutil.ReadFile(*keysFile)
+	if err != nil {
+		log.Fatalf("failed to read key ring: %v", err)
+	}
+	keys, err := mirror.ParseKeyRing(keyData)
+	if err != nil {
+		log.Fatalf("failed to parse key ring: %v", err)
+	}
+	m, err := mirror.NewServer(db, *height, audit.SplitVerifierKeys(*vkey), keys)
+	if err != nil {
+		log.Fatalf("failed to create mirror: %v", err)
+	}
+
+	log.Printf("Serving mirror on %s", *listen)
+	log.Fatal(http.ListenAndServe(*listen, m))
+}
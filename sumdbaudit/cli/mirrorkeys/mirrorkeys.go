@@ -0,0 +1,109 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/trillian-examples/sumdbaudit/mirror"
+	"golang.org/x/mod/sumdb/note"
+)
+
+var (
+	keysFile = flag.String("keys_file", "./mirror.keys", "file containing the key ring (will be created if it doesn't exist)")
+)
+
+const usage = `usage: mirrorkeys [flags] <command>
+
+Commands:
+  generate <name>         adds a new key with the given name, and prints its verifier key
+  list                    prints the verifier key and expiry of each key
+  retire <vkey> <time>    sets the RFC 3339 time after which the key with the given
+                          verifier key, as printed by generate or list, will no longer sign
+`
+
+// Manages the key ring used by the mirror to cosign checkpoints. To rotate keys,
+// generate a new key and retire the old one at a time far enough in the future
+// for verifiers to have switched to the new verifier key.
+func main() {
+	log.SetPrefix("mirrorkeys: ")
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	kr, err := readKeyRing(*keysFile)
+	if err != nil {
+		log.Fatalf("failed to read key ring: %v", err)
+	}
+
+	switch {
+	case flag.NArg() == 2 && flag.Arg(0) == "generate":
+		skey, vkey, err := note.GenerateKey(rand.Reader, flag.Arg(1))
+		if err != nil {
+			log.Fatalf("failed to generate key: %v", err)
+		}
+		kr.Keys = append(kr.Keys, mirror.Key{SKey: skey})
+		if err := ioutil.WriteFile(*keysFile, kr.Marshal(), 0600); err != nil {
+			log.Fatalf("failed to write key ring: %v", err)
+		}
+		fmt.Println(vkey)
+	case flag.NArg() == 1 && flag.Arg(0) == "list":
+		for _, k := range kr.Keys {
+			vkey, err := k.VerifierKey()
+			if err != nil {
+				log.Fatalf("invalid key in key ring: %v", err)
+			}
+			expiry := "never"
+			if !k.NotAfter.IsZero() {
+				expiry = k.NotAfter.UTC().Format(time.RFC3339)
+			}
+			fmt.Printf("%s expires: %s\n", vkey, expiry)
+		}
+	case flag.NArg() == 3 && flag.Arg(0) == "retire":
+		notAfter, err := time.Parse(time.RFC3339, flag.Arg(2))
+		if err != nil {
+			log.Fatalf("invalid time: %v", err)
+		}
+		if err := kr.Retire(flag.Arg(1), notAfter); err != nil {
+			log.Fatal(err)
+		}
+		if err := ioutil.WriteFile(*keysFile, kr.Marshal(), 0600); err != nil {
+			log.Fatalf("failed to write key ring: %v", err)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func readKeyRing(path string) (*mirror.KeyRing, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &mirror.KeyRing{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mirror.ParseKeyRing(data)
+}
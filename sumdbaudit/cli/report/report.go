@@ -0,0 +1,92 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/google/trillian-examples/sumdbaudit/audit"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	height   = flag.Int("h", 8, "tile height")
+	vkey     = flag.String("k", "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8", "comma separated verifier keys of the SumDB")
+	dbDriver = flag.String("db_driver", audit.DriverSQLite, "database driver to use; sqlite3 or postgres")
+	db       = flag.String("db", "./sum.db", "database file location, or connection string if using postgres")
+	format   = flag.String("format", "json", "format of the report; json or csv")
+	out      = flag.String("out", "", "file to write the report to; if empty the report is written to stdout")
+)
+
+// Reports every version of a module recorded in a local clone created by the
+// clone tool, along with the hashes, leaf index, and the first verified
+// checkpoint that included each version. Appending /... to the module path
+// reports on all modules beneath it as well, e.g. golang.org/x/... for all
+// modules under golang.org/x.
+func main() {
+	ctx := context.Background()
+
+	log.SetPrefix("report: ")
+	log.SetFlags(0)
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		log.Fatalf("usage: report [flags] module[/...]")
+	}
+	var write func(io.Writer, []audit.ModuleVersion) error
+	switch *format {
+	case "json":
+		write = audit.WriteHistoryJSON
+	case "csv":
+		write = audit.WriteHistoryCSV
+	default:
+		log.Fatalf("unsupported --format %q; expected json or csv", *format)
+	}
+
+	db, err := audit.NewDatabaseWithDriver(*dbDriver, *db)
+	if err != nil {
+		log.Fatalf("failed to open DB: %v", err)
+	}
+	sumDB, err := audit.NewSumDBWithKeys(*height, audit.SplitVerifierKeys(*vkey), audit.HTTPOptions{})
+	if err != nil {
+		log.Fatalf("invalid -k: %v", err)
+	}
+	s := audit.NewService(db, sumDB, *height)
+	history, err := s.ModuleHistory(ctx, flag.Arg(0))
+	if err != nil {
+		log.Fatalf("ModuleHistory: %v", err)
+	}
+	if len(history) == 0 {
+		log.Fatalf("no versions of %s found", flag.Arg(0))
+	}
+
+	w := os.Stdout
+	if len(*out) > 0 {
+		if w, err = os.Create(*out); err != nil {
+			log.Fatalf("failed to create report: %v", err)
+		}
+	}
+	if err := write(w, history); err != nil {
+		log.Fatalf("failed to write report: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatalf("failed to write report: %v", err)
+	}
+}
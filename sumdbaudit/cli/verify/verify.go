@@ -0,0 +1,83 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/google/trillian-examples/sumdbaudit/audit"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	height           = flag.Int("h", 8, "tile height")
+	vkey             = flag.String("k", "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8", "comma separated verifier keys of the SumDB")
+	dbDriver         = flag.String("db_driver", audit.DriverSQLite, "database driver to use; sqlite3 or postgres")
+	db               = flag.String("db", "./sum.db", "database file location, or connection string if using postgres")
+	progressInterval = flag.Duration("progress_interval", 30*time.Second, "interval at which to log the progress of verification, or 0 to disable")
+)
+
+// Checks the integrity of a local clone created by the clone tool, without
+// contacting the SumDB. All tiles and the root hash are recalculated from the
+// local leaves and compared against the last checkpoint that the clone was
+// verified against. Any corrupt tiles are reported along with the range of
+// leaves that they cover.
+func main() {
+	ctx := context.Background()
+
+	log.SetPrefix("verify: ")
+	log.SetFlags(0)
+	flag.Parse()
+
+	db, err := audit.NewDatabaseWithDriver(*dbDriver, *db)
+	if err != nil {
+		log.Fatalf("failed to open DB: %v", err)
+	}
+	sumDB, err := audit.NewSumDBWithKeys(*height, audit.SplitVerifierKeys(*vkey), audit.HTTPOptions{})
+	if err != nil {
+		log.Fatalf("invalid -k: %v", err)
+	}
+	checkpoint, err := db.GoldenCheckpoint(sumDB.ParseStoredCheckpoint)
+	if err != nil {
+		log.Fatalf("failed to get verified checkpoint: %v", err)
+	}
+
+	log.Printf("Verifying local data against checkpoint for %d entries...", checkpoint.N)
+	s := audit.NewService(db, sumDB, *height)
+	if *progressInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(*progressInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				log.Printf("Progress: %s", s.Progress())
+			}
+		}()
+	}
+	corruptions, err := s.VerifyLocal(ctx, &checkpoint.Tree)
+	if err != nil {
+		log.Fatalf("VerifyLocal: %v", err)
+	}
+	for _, c := range corruptions {
+		log.Printf("Corrupt: %s", c)
+	}
+	if len(corruptions) > 0 {
+		log.Fatalf("Found %d corrupt ranges", len(corruptions))
+	}
+	log.Printf("Local data is consistent with tree size %d, hash %x (%s)", checkpoint.N, checkpoint.Hash[:], checkpoint.Hash)
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+// algEd25519 is the algorithm identifier used by note for Ed25519 keys.
+const algEd25519 = 1
+
+// Key is a note signer key that a mirror signs checkpoints with.
+type Key struct {
+	// SKey is the encoded note signer key.
+	SKey string
+	// NotAfter is the time after which this key should no longer be used.
+	// The zero time means that the key does not expire.
+	NotAfter time.Time
+}
+
+// Active returns true if the key should be used for signing at the given time.
+func (k Key) Active(now time.Time) bool {
+	return k.NotAfter.IsZero() || now.Before(k.NotAfter)
+}
+
+// VerifierKey returns the encoded note verifier key for this signer key.
+func (k Key) VerifierKey() (string, error) {
+	// The signer key is PRIVATE+KEY+name+hash+base64(alg||seed).
+	parts := strings.SplitN(k.SKey, "+", 5)
+	if len(parts) != 5 || parts[0] != "PRIVATE" || parts[1] != "KEY" {
+		return "", fmt.Errorf("malformed signer key")
+	}
+	name, hash, enc := parts[2], parts[3], parts[4]
+	key, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return "", fmt.Errorf("malformed signer key: %v", err)
+	}
+	if len(key) != 1+ed25519.SeedSize || key[0] != algEd25519 {
+		return "", fmt.Errorf("unsupported signer key")
+	}
+	pub := ed25519.NewKeyFromSeed(key[1:]).Public().(ed25519.PublicKey)
+	vkey := name + "+" + hash + "+" + base64.StdEncoding.EncodeToString(append([]byte{algEd25519}, pub...))
+	// Check that the hash in the key matches, which NewVerifier does for us.
+	if _, err := note.NewVerifier(vkey); err != nil {
+		return "", err
+	}
+	return vkey, nil
+}
+
+// KeyRing is the set of keys that a mirror signs checkpoints with. Keys can be
+// rotated by adding a new key and setting an expiry time on the old one. Both
+// keys sign checkpoints until the old key expires, which gives verifiers a
+// window in which to switch to the new key.
+type KeyRing struct {
+	Keys []Key
+}
+
+// ParseKeyRing parses a key ring from its text form. Each non-empty line that
+// doesn't start with '#' is a note signer key, optionally followed by an RFC
+// 3339 timestamp after which that key is no longer used.
+func ParseKeyRing(data []byte) (*KeyRing, error) {
+	var kr KeyRing
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: expected key and optional expiry, but got %d fields", line, len(fields))
+		}
+		k := Key{SKey: fields[0]}
+		if _, err := note.NewSigner(k.SKey); err != nil {
+			return nil, fmt.Errorf("line %d: invalid signer key: %v", line, err)
+		}
+		if len(fields) == 2 {
+			t, err := time.Parse(time.RFC3339, fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid expiry: %v", line, err)
+			}
+			k.NotAfter = t
+		}
+		kr.Keys = append(kr.Keys, k)
+	}
+	return &kr, s.Err()
+}
+
+// Marshal returns the text form of the key ring, suitable for ParseKeyRing.
+func (kr *KeyRing) Marshal() []byte {
+	var b bytes.Buffer
+	for _, k := range kr.Keys {
+		b.WriteString(k.SKey)
+		if !k.NotAfter.IsZero() {
+			b.WriteString(" " + k.NotAfter.UTC().Format(time.RFC3339))
+		}
+		b.WriteString("\n")
+	}
+	return b.Bytes()
+}
+
+// Retire sets the time after which the key with the given verifier key will no
+// longer sign. Keys are selected by their verifier key rather than by name, as
+// keys are usually rotated to a new key with the same name.
+func (kr *KeyRing) Retire(vkey string, notAfter time.Time) error {
+	for i, k := range kr.Keys {
+		v, err := k.VerifierKey()
+		if err != nil {
+			return err
+		}
+		if v == vkey {
+			kr.Keys[i].NotAfter = notAfter
+			return nil
+		}
+	}
+	return fmt.Errorf("no key with verifier key %q", vkey)
+}
+
+// Signers returns signers for all of the keys which are active at the given time.
+func (kr *KeyRing) Signers(now time.Time) ([]note.Signer, error) {
+	var res []note.Signer
+	for _, k := range kr.Keys {
+		if !k.Active(now) {
+			continue
+		}
+		s, err := note.NewSigner(k.SKey)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
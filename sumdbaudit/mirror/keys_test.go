@@ -0,0 +1,146 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"crypto/rand"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+func generateKey(t *testing.T, name string) (string, string) {
+	t.Helper()
+	skey, vkey, err := note.GenerateKey(rand.Reader, name)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return skey, vkey
+}
+
+func TestVerifierKey(t *testing.T) {
+	skey, vkey := generateKey(t, "mirror.example.com")
+	got, err := Key{SKey: skey}.VerifierKey()
+	if err != nil {
+		t.Fatalf("VerifierKey: %v", err)
+	}
+	if got != vkey {
+		t.Errorf("got %q, want %q", got, vkey)
+	}
+}
+
+func TestKeyRingRoundTrip(t *testing.T) {
+	oldKey, _ := generateKey(t, "old.example.com")
+	newKey, _ := generateKey(t, "new.example.com")
+	expiry := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	text := fmt.Sprintf("# Mirror keys\n%s %s\n\n%s\n", oldKey, expiry.Format(time.RFC3339), newKey)
+
+	kr, err := ParseKeyRing([]byte(text))
+	if err != nil {
+		t.Fatalf("ParseKeyRing: %v", err)
+	}
+	if got, want := len(kr.Keys), 2; got != want {
+		t.Fatalf("got %d keys, want %d", got, want)
+	}
+	if got, want := kr.Keys[0].NotAfter, expiry; !got.Equal(want) {
+		t.Errorf("got expiry %v, want %v", got, want)
+	}
+	if !kr.Keys[1].NotAfter.IsZero() {
+		t.Errorf("got expiry %v for key without expiry", kr.Keys[1].NotAfter)
+	}
+
+	kr2, err := ParseKeyRing(kr.Marshal())
+	if err != nil {
+		t.Fatalf("ParseKeyRing(Marshal()): %v", err)
+	}
+	if got, want := string(kr2.Marshal()), string(kr.Marshal()); got != want {
+		t.Errorf("round trip changed key ring: got %q, want %q", got, want)
+	}
+}
+
+func TestParseKeyRingErrors(t *testing.T) {
+	skey, _ := generateKey(t, "mirror.example.com")
+	for _, text := range []string{
+		"not a key\n",
+		skey + " yesterday\n",
+		skey + " 2021-01-02T03:04:05Z extra\n",
+	} {
+		if _, err := ParseKeyRing([]byte(text)); err == nil {
+			t.Errorf("expected error parsing %q", text)
+		}
+	}
+}
+
+func TestSignersRotation(t *testing.T) {
+	oldKey, _ := generateKey(t, "old.example.com")
+	newKey, _ := generateKey(t, "new.example.com")
+	expiry := time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)
+	kr := &KeyRing{Keys: []Key{{SKey: oldKey, NotAfter: expiry}, {SKey: newKey}}}
+
+	for _, test := range []struct {
+		now  time.Time
+		want []string
+	}{
+		{now: expiry.Add(-time.Hour), want: []string{"old.example.com", "new.example.com"}},
+		{now: expiry, want: []string{"new.example.com"}},
+	} {
+		signers, err := kr.Signers(test.now)
+		if err != nil {
+			t.Fatalf("Signers: %v", err)
+		}
+		var got []string
+		for _, s := range signers {
+			got = append(got, s.Name())
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("at %v got signers %v, want %v", test.now, got, test.want)
+		}
+	}
+}
+
+func TestRetireSameName(t *testing.T) {
+	oldKey, oldVKey := generateKey(t, "mirror.example.com")
+	newKey, newVKey := generateKey(t, "mirror.example.com")
+	kr := &KeyRing{Keys: []Key{{SKey: oldKey}, {SKey: newKey}}}
+	expiry := time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	if err := kr.Retire(oldVKey, expiry); err != nil {
+		t.Fatalf("Retire: %v", err)
+	}
+	if !kr.Keys[0].NotAfter.Equal(expiry) || !kr.Keys[1].NotAfter.IsZero() {
+		t.Fatalf("got expiries %v and %v, want only the old key to expire", kr.Keys[0].NotAfter, kr.Keys[1].NotAfter)
+	}
+	// Only the new key signs once the old one has been retired.
+	signers, err := kr.Signers(expiry)
+	if err != nil {
+		t.Fatalf("Signers: %v", err)
+	}
+	if len(signers) != 1 {
+		t.Fatalf("got %d signers, want 1", len(signers))
+	}
+	v, err := note.NewVerifier(newVKey)
+	if err != nil {
+		t.Fatalf("failed to create verifier: %v", err)
+	}
+	if signers[0].KeyHash() != v.KeyHash() {
+		t.Errorf("got signer with hash %08x, want the new key %08x", signers[0].KeyHash(), v.KeyHash())
+	}
+
+	if err := kr.Retire("mirror.example.com", expiry); err == nil {
+		t.Error("expected error retiring a key by name")
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mirror serves a verified local clone of the SumDB using the same
+// HTTP API as the SumDB itself. The checkpoint served is cosigned by the keys
+// of the mirror, in addition to the original SumDB signature.
+package mirror
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/trillian-examples/sumdbaudit/audit"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// Server is an http.Handler which serves the /latest checkpoint and tiles
+// from the local clone. If the leaf data in the clone has been pruned, each
+// request for a pruned data tile is served by fetching it from the SumDB again,
+// so mirrors should generally serve unpruned clones.
+type Server struct {
+	db     *audit.Database
+	sumDB  *audit.SumDBClient
+	s      *audit.Service
+	keys   *KeyRing
+	height int
+}
+
+// NewServer creates a Server for the clone in the given database, which must
+// have been created with tiles of the given height. The vkeys are the verifier
+// keys of the SumDB that was cloned.
+func NewServer(db *audit.Database, height int, vkeys []string, keys *KeyRing) (*Server, error) {
+	sumDB, err := audit.NewSumDBWithKeys(height, vkeys, audit.HTTPOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		db:     db,
+		sumDB:  sumDB,
+		s:      audit.NewService(db, sumDB, height),
+		keys:   keys,
+		height: height,
+	}, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (m *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case r.URL.Path == "/latest":
+		m.serveLatest(w, r)
+	case strings.HasPrefix(r.URL.Path, "/tile/"):
+		m.serveTile(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *Server) serveLatest(w http.ResponseWriter, r *http.Request) {
+	checkpoint, err := m.db.GoldenCheckpoint(m.sumDB.ParseStoredCheckpoint)
+	if err != nil {
+		log.Printf("failed to get checkpoint: %v", err)
+		http.Error(w, "no checkpoint available", http.StatusServiceUnavailable)
+		return
+	}
+	signed, err := m.cosign(checkpoint, time.Now())
+	if err != nil {
+		log.Printf("failed to cosign checkpoint: %v", err)
+		http.Error(w, "failed to sign checkpoint", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(signed)
+}
+
+// cosign adds signatures from all of the keys active at the given time to the
+// note of the verified checkpoint, keeping the original SumDB signature. It is
+// an error for no keys to be active, as the checkpoint would not be cosigned.
+func (m *Server) cosign(checkpoint *audit.Checkpoint, now time.Time) ([]byte, error) {
+	v, err := note.NewVerifier(checkpoint.VerifierKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create verifier: %v", err)
+	}
+	n, err := note.Open(checkpoint.Raw, note.VerifierList(v))
+	if err != nil {
+		return nil, err
+	}
+	signers, err := m.keys.Signers(now)
+	if err != nil {
+		return nil, err
+	}
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("no mirror keys are active at %v", now)
+	}
+	return note.Sign(n, signers...)
+}
+
+func (m *Server) serveTile(w http.ResponseWriter, r *http.Request) {
+	t, err := tlog.ParseTilePath(strings.TrimPrefix(r.URL.Path, "/"))
+	if err != nil {
+		http.Error(w, "invalid tile path", http.StatusBadRequest)
+		return
+	}
+	if t.H != m.height {
+		http.Error(w, fmt.Sprintf("only tiles of height %d are available", m.height), http.StatusNotFound)
+		return
+	}
+	checkpoint, err := m.db.GoldenCheckpoint(m.sumDB.ParseStoredCheckpoint)
+	if err != nil {
+		log.Printf("failed to get checkpoint: %v", err)
+		http.Error(w, "no checkpoint available", http.StatusServiceUnavailable)
+		return
+	}
+	if !tileWithin(t, checkpoint.N) {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := m.s.TileData(t)
+	if err != nil {
+		log.Printf("failed to get tile %s: %v", t.Path(), err)
+		http.Error(w, "failed to get tile", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if t.W == 1<<uint(t.H) {
+		// Complete tiles never change.
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	w.Write(data)
+}
+
+// tileWithin returns true if the tile only covers leaves within a tree of size n.
+func tileWithin(t tlog.Tile, n int64) bool {
+	level := t.L
+	if level < 0 {
+		level = 0
+	}
+	end := (t.N<<uint(t.H) + int64(t.W)) << uint(level*t.H)
+	return end <= n
+}
@@ -0,0 +1,296 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/trillian-examples/sumdbaudit/audit"
+	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestTileWithin(t *testing.T) {
+	for _, test := range []struct {
+		tile tlog.Tile
+		n    int64
+		want bool
+	}{
+		{tile: tlog.Tile{H: 2, L: 0, N: 0, W: 4}, n: 4, want: true},
+		{tile: tlog.Tile{H: 2, L: 0, N: 1, W: 4}, n: 7, want: false},
+		{tile: tlog.Tile{H: 2, L: 0, N: 1, W: 3}, n: 7, want: true},
+		{tile: tlog.Tile{H: 2, L: -1, N: 1, W: 4}, n: 8, want: true},
+		{tile: tlog.Tile{H: 2, L: 1, N: 0, W: 4}, n: 15, want: false},
+		{tile: tlog.Tile{H: 2, L: 1, N: 0, W: 3}, n: 15, want: true},
+	} {
+		if got := tileWithin(test.tile, test.n); got != test.want {
+			t.Errorf("tileWithin(%s, %d): got %t, want %t", test.tile.Path(), test.n, got, test.want)
+		}
+	}
+}
+
+func TestCosign(t *testing.T) {
+	logSKey, logVKey := generateKey(t, "log.example.com")
+	mirrorSKey, mirrorVKey := generateKey(t, "mirror.example.com")
+	logSigner, err := note.NewSigner(logSKey)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	raw, err := note.Sign(&note.Note{Text: "go.sum database tree\n10\nkn9DgqDhXzoZMM8828SQsbuovr/WRn7QfFd5Qe1rpwA=\n"}, logSigner)
+	if err != nil {
+		t.Fatalf("failed to sign checkpoint: %v", err)
+	}
+
+	expiry := time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)
+	m, err := NewServer(nil, 8, []string{logVKey}, &KeyRing{Keys: []Key{{SKey: mirrorSKey, NotAfter: expiry}}})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	checkpoint, err := m.sumDB.ParseCheckpointNote(raw)
+	if err != nil {
+		t.Fatalf("ParseCheckpointNote: %v", err)
+	}
+	cosigned, err := m.cosign(checkpoint, expiry.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("cosign: %v", err)
+	}
+
+	for _, vkey := range []string{logVKey, mirrorVKey} {
+		v, err := note.NewVerifier(vkey)
+		if err != nil {
+			t.Fatalf("failed to create verifier: %v", err)
+		}
+		if _, err := note.Open(cosigned, note.VerifierList(v)); err != nil {
+			t.Errorf("cosigned checkpoint did not verify with %s: %v", v.Name(), err)
+		}
+	}
+
+	if _, err := m.cosign(checkpoint, expiry); err == nil {
+		t.Error("expected error cosigning once all mirror keys have expired")
+	}
+}
+
+// upstream is a SumDB serving the tiles of a log with tiles of height 2.
+type upstream struct {
+	vkey   string
+	values map[string][]byte
+
+	mu       sync.Mutex
+	requests map[string]int // Number of requests for each path
+}
+
+func newUpstream(t *testing.T, leaves []string) *upstream {
+	t.Helper()
+	skey, vkey := generateKey(t, "sumdb.example.com")
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	var stored []tlog.Hash
+	hashes := tlog.HashReaderFunc(func(indexes []int64) ([]tlog.Hash, error) {
+		r := make([]tlog.Hash, len(indexes))
+		for i, x := range indexes {
+			r[i] = stored[x]
+		}
+		return r, nil
+	})
+	for i, l := range leaves {
+		hs, err := tlog.StoredHashes(int64(i), []byte(l), hashes)
+		if err != nil {
+			t.Fatalf("StoredHashes: %v", err)
+		}
+		stored = append(stored, hs...)
+	}
+	u := &upstream{vkey: vkey, values: make(map[string][]byte), requests: make(map[string]int)}
+	size := int64(len(leaves))
+	for n := int64(1); n <= size; n++ {
+		for _, tile := range tlog.NewTiles(2, n-1, n) {
+			data, err := tlog.ReadTileData(tile, hashes)
+			if err != nil {
+				t.Fatalf("ReadTileData(%s): %v", tile.Path(), err)
+			}
+			u.values["/"+tile.Path()] = data
+			if tile.L == 0 {
+				start := tile.N << uint(tile.H)
+				tile.L = -1
+				u.values["/"+tile.Path()] = []byte(strings.Join(leaves[start:start+int64(tile.W)], "\n"))
+			}
+		}
+	}
+	hash, err := tlog.TreeHash(size, hashes)
+	if err != nil {
+		t.Fatalf("TreeHash: %v", err)
+	}
+	if u.values["/latest"], err = note.Sign(&note.Note{Text: string(tlog.FormatTree(tlog.Tree{N: size, Hash: hash}))}, signer); err != nil {
+		t.Fatalf("failed to sign checkpoint: %v", err)
+	}
+	return u
+}
+
+func (u *upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	u.requests[r.URL.Path]++
+	u.mu.Unlock()
+	data, ok := u.values[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(data)
+}
+
+func (u *upstream) count(path string) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.requests[path]
+}
+
+func TestServeHTTP(t *testing.T) {
+	var leaves []string
+	for i := 0; i < 9; i++ {
+		leaves = append(leaves, fmt.Sprintf("example.com/m v1.0.%d h1:repo%d=\nexample.com/m v1.0.%d/go.mod h1:mod%d=\n", i, i, i, i))
+	}
+	u := newUpstream(t, leaves)
+	ts := httptest.NewServer(u)
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "mirror")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := audit.NewDatabase(filepath.Join(dir, "sum.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	if err := db.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	sumDB, err := audit.NewSumDBWithKeys(2, []string{u.vkey}, audit.HTTPOptions{BaseURL: ts.URL})
+	if err != nil {
+		t.Fatalf("NewSumDBWithKeys: %v", err)
+	}
+	mirrorSKey, mirrorVKey := generateKey(t, "mirror.example.com")
+	s := audit.NewService(db, sumDB, 2)
+	m := &Server{db: db, sumDB: sumDB, s: s, keys: &KeyRing{Keys: []Key{{SKey: mirrorSKey}}}, height: 2}
+
+	get := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	// Nothing is served until a checkpoint has been verified.
+	for _, path := range []string{"/latest", "/tile/2/0/000"} {
+		if got, want := get(http.MethodGet, path).Code, http.StatusServiceUnavailable; got != want {
+			t.Errorf("GET %s before clone: got status %d, want %d", path, got, want)
+		}
+	}
+
+	ctx := context.Background()
+	cp, err := sumDB.LatestCheckpoint()
+	if err != nil {
+		t.Fatalf("LatestCheckpoint: %v", err)
+	}
+	if err := s.CloneLeafTiles(ctx, &cp.Tree, 1); err != nil {
+		t.Fatalf("CloneLeafTiles: %v", err)
+	}
+	if err := s.HashTiles(ctx, &cp.Tree); err != nil {
+		t.Fatalf("HashTiles: %v", err)
+	}
+	if err := s.CheckRootHash(ctx, &cp.Tree); err != nil {
+		t.Fatalf("CheckRootHash: %v", err)
+	}
+	if err := db.SetGoldenCheckpoint(cp); err != nil {
+		t.Fatalf("SetGoldenCheckpoint: %v", err)
+	}
+
+	w := get(http.MethodGet, "/latest")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /latest: got status %d, want %d", w.Code, http.StatusOK)
+	}
+	for _, vkey := range []string{u.vkey, mirrorVKey} {
+		v, err := note.NewVerifier(vkey)
+		if err != nil {
+			t.Fatalf("failed to create verifier: %v", err)
+		}
+		n, err := note.Open(w.Body.Bytes(), note.VerifierList(v))
+		if err != nil {
+			t.Fatalf("GET /latest did not verify with %s: %v", v.Name(), err)
+		}
+		if got, want := n.Text, string(tlog.FormatTree(cp.Tree)); got != want {
+			t.Errorf("GET /latest: got tree %q, want %q", got, want)
+		}
+	}
+
+	for _, test := range []struct {
+		method, path string
+		wantCode     int
+	}{
+		{method: http.MethodGet, path: "/tile/2/0/000", wantCode: http.StatusOK},
+		{method: http.MethodGet, path: "/tile/2/0/001", wantCode: http.StatusOK},
+		{method: http.MethodGet, path: "/tile/2/0/002.p/1", wantCode: http.StatusOK},
+		{method: http.MethodGet, path: "/tile/2/1/000.p/2", wantCode: http.StatusOK},
+		{method: http.MethodGet, path: "/tile/2/data/001", wantCode: http.StatusOK},
+		{method: http.MethodGet, path: "/tile/2/data/002.p/1", wantCode: http.StatusOK},
+		{method: http.MethodGet, path: "/tile/2/0/002", wantCode: http.StatusNotFound},
+		{method: http.MethodGet, path: "/tile/3/0/000", wantCode: http.StatusNotFound},
+		{method: http.MethodGet, path: "/tile/2/x/000", wantCode: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/lookup/example.com/m@v1.0.0", wantCode: http.StatusNotFound},
+		{method: http.MethodPost, path: "/latest", wantCode: http.StatusMethodNotAllowed},
+	} {
+		w := get(test.method, test.path)
+		if w.Code != test.wantCode {
+			t.Errorf("%s %s: got status %d, want %d", test.method, test.path, w.Code, test.wantCode)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		if want := u.values[test.path]; !bytes.Equal(w.Body.Bytes(), want) {
+			t.Errorf("%s %s: got %q, want %q", test.method, test.path, w.Body.Bytes(), want)
+		}
+	}
+
+	// Pruned data tiles are fetched from the SumDB again for every request.
+	if err := s.PruneLeaves(&cp.Tree, 0); err != nil {
+		t.Fatalf("PruneLeaves: %v", err)
+	}
+	const pruned = "/tile/2/data/000"
+	for i := 1; i <= 2; i++ {
+		w := get(http.MethodGet, pruned)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s after pruning: got status %d, want %d", pruned, w.Code, http.StatusOK)
+		}
+		if want := u.values[pruned]; !bytes.Equal(w.Body.Bytes(), want) {
+			t.Errorf("GET %s after pruning: got %q, want %q", pruned, w.Body.Bytes(), want)
+		}
+		if got, want := u.count(pruned), 1+i; got != want {
+			t.Errorf("got %d requests upstream for %s, want %d", got, pruned, want)
+		}
+	}
+}